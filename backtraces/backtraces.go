@@ -0,0 +1,285 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backtraces captures the backtraces of Passenger processes into a
+// diagnostics directory when an app looks stuck.
+package backtraces
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nex-health/passenger-exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons for a capture.
+const (
+	ReasonBusy  = "busy"
+	ReasonQueue = "queue"
+)
+
+const (
+	filePrefix = "backtraces-"
+	fileSuffix = ".txt"
+	// fileTimeFormat sorts lexically in time order.
+	fileTimeFormat = "20060102T150405.000Z"
+)
+
+// Reader reads backtraces.txt from the Passenger core API.
+type Reader interface {
+	Backtraces() (io.ReadCloser, error)
+}
+
+type Config struct {
+	// Dir is the diagnostics directory the captures are saved to.
+	Dir string
+	// BusyFor captures when every process of an app has been busy for this
+	// long. 0 disables the condition.
+	BusyFor time.Duration
+	// QueueAbove captures when more requests than this wait in the queue of
+	// an app. 0 disables the condition.
+	QueueAbove int
+	// MinInterval is the least time between two captures triggered by the
+	// same app.
+	MinInterval time.Duration
+	// Keep is the number of captures kept in Dir, the oldest being removed
+	// first. 0 keeps all.
+	Keep int
+}
+
+// Capturer observes the pools read by the collector and captures backtraces
+// when one of the conditions of its config holds for an app. Captures are
+// rate limited per app, so an app that keeps looking stuck does not hold up
+// the captures of the others. They are taken in the background, so scrapes do
+// not wait for them.
+type Capturer struct {
+	reader Reader
+	config Config
+	logger *slog.Logger
+
+	captures *prometheus.CounterVec
+	failures prometheus.Counter
+
+	mu        sync.Mutex
+	busySince map[string]time.Time
+	// lastCapture holds when each app last triggered a capture.
+	lastCapture map[string]time.Time
+	capturing   sync.WaitGroup
+}
+
+// trigger is a condition that held for an app.
+type trigger struct {
+	app, reason string
+}
+
+func New(reader Reader, config Config, logger *slog.Logger) (*Capturer, error) {
+	if config.Dir == "" {
+		return nil, fmt.Errorf("no diagnostics directory to save backtraces to")
+	}
+	if err := os.MkdirAll(config.Dir, 0750); err != nil {
+		return nil, err
+	}
+
+	captures := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "passenger",
+		Name:      "backtrace_captures_total",
+		Help:      "Number of backtrace captures taken, by the condition that triggered them.",
+	}, []string{"reason"})
+	for _, reason := range []string{ReasonBusy, ReasonQueue} {
+		captures.WithLabelValues(reason)
+	}
+	return &Capturer{
+		reader:   reader,
+		config:   config,
+		logger:   logger,
+		captures: captures,
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "passenger",
+			Name:      "backtrace_capture_failures_total",
+			Help:      "Number of backtrace captures that failed.",
+		}),
+		busySince:   make(map[string]time.Time),
+		lastCapture: make(map[string]time.Time),
+	}, nil
+}
+
+func (c *Capturer) Describe(ch chan<- *prometheus.Desc) {
+	c.captures.Describe(ch)
+	c.failures.Describe(ch)
+}
+
+func (c *Capturer) Collect(ch chan<- prometheus.Metric) {
+	c.captures.Collect(ch)
+	c.failures.Collect(ch)
+}
+
+// Observe captures backtraces if a condition holds for an app of info that
+// has not triggered a capture within the min interval. The apps it holds for
+// at once share a capture.
+func (c *Capturer) Observe(at time.Time, info *collector.Info) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var triggers []trigger
+	seen := make(map[string]bool)
+	for _, sg := range info.SuperGroups {
+		seen[sg.Name] = true
+		busy := c.busy(&sg, at)
+		var reason string
+		switch {
+		case c.config.BusyFor > 0 && busy:
+			reason = ReasonBusy
+		case c.config.QueueAbove > 0 && sg.Queue() > c.config.QueueAbove:
+			reason = ReasonQueue
+		default:
+			continue
+		}
+		if last, ok := c.lastCapture[sg.Name]; ok && at.Sub(last) < c.config.MinInterval {
+			continue
+		}
+		c.lastCapture[sg.Name] = at
+		triggers = append(triggers, trigger{sg.Name, reason})
+	}
+	for _, apps := range []map[string]time.Time{c.busySince, c.lastCapture} {
+		for name := range apps {
+			if !seen[name] {
+				delete(apps, name)
+			}
+		}
+	}
+
+	if len(triggers) == 0 {
+		return
+	}
+	c.capturing.Go(func() { c.capture(at, triggers) })
+}
+
+// busy reports whether every process of sg has been saturated since at least
+// the busy threshold, remembering since when they have been.
+func (c *Capturer) busy(sg *collector.SuperGroup, at time.Time) bool {
+	processes := 0
+	for _, group := range sg.Groups {
+		for _, proc := range group.Processes {
+			if !saturated(&proc) {
+				delete(c.busySince, sg.Name)
+				return false
+			}
+			processes++
+		}
+	}
+	if processes == 0 {
+		delete(c.busySince, sg.Name)
+		return false
+	}
+
+	since, ok := c.busySince[sg.Name]
+	if !ok {
+		since = at
+		c.busySince[sg.Name] = at
+	}
+	return at.Sub(since) >= c.config.BusyFor
+}
+
+// saturated reports whether proc handles as many sessions as it can, or any
+// session if its concurrency is unlimited or unknown.
+func saturated(proc *collector.Process) bool {
+	sessions, err := strconv.Atoi(proc.Sessions)
+	if err != nil {
+		return false
+	}
+	concurrency, err := strconv.Atoi(proc.Concurrency)
+	if err != nil || concurrency == 0 {
+		return sessions > 0
+	}
+	return sessions >= concurrency
+}
+
+// capture saves the backtraces of all processes at at and removes the oldest
+// captures past the ones to keep. The capture is counted once for each
+// condition among triggers.
+func (c *Capturer) capture(at time.Time, triggers []trigger) {
+	var conditions, apps, reasons []string
+	for _, t := range triggers {
+		conditions = append(conditions, "condition "+t.reason+" held for "+t.app)
+		apps = append(apps, t.app)
+		if !slices.Contains(reasons, t.reason) {
+			reasons = append(reasons, t.reason)
+		}
+	}
+	path, err := c.save(at, strings.Join(conditions, ", "))
+	if err != nil {
+		c.failures.Inc()
+		c.logger.Error("Error capturing backtraces", "apps", apps, "reasons", reasons, "err", err)
+		return
+	}
+	for _, reason := range reasons {
+		c.captures.WithLabelValues(reason).Inc()
+	}
+	c.logger.Info("Captured backtraces", "apps", apps, "reasons", reasons, "path", path)
+
+	if err := c.rotate(); err != nil {
+		c.logger.Error("Error removing old backtraces", "dir", c.config.Dir, "err", err)
+	}
+}
+
+func (c *Capturer) save(at time.Time, conditions string) (string, error) {
+	backtraces, err := c.reader.Backtraces()
+	if err != nil {
+		return "", err
+	}
+	defer backtraces.Close()
+
+	// Written under a name rotation ignores until complete.
+	path := filepath.Join(c.config.Dir, filePrefix+at.UTC().Format(fileTimeFormat)+fileSuffix)
+	tmp, err := os.CreateTemp(c.config.Dir, ".backtraces-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	fmt.Fprintf(tmp, "# Captured at %s, %s\n\n", at.UTC().Format(time.RFC3339), conditions)
+	if _, err := io.Copy(tmp, backtraces); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+func (c *Capturer) rotate() error {
+	captures, err := filepath.Glob(filepath.Join(c.config.Dir, filePrefix+"*"+fileSuffix))
+	if err != nil {
+		return err
+	}
+	if c.config.Keep == 0 || len(captures) <= c.config.Keep {
+		return nil
+	}
+	slices.Sort(captures)
+	for _, path := range captures[:len(captures)-c.config.Keep] {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
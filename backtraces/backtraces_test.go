@@ -0,0 +1,187 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backtraces
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nex-health/passenger-exporter/collector"
+	"github.com/nex-health/passenger-exporter/passengertest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promslog"
+)
+
+type fakeReader struct {
+	err error
+}
+
+func (r *fakeReader) Backtraces() (io.ReadCloser, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return io.NopCloser(strings.NewReader("Thread 1:\n    in 'block in accept'\n")), nil
+}
+
+func captures(t *testing.T, dir string) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "backtraces-*.txt"))
+	if err != nil {
+		t.Fatalf("failed to list captures: %v", err)
+	}
+	return paths
+}
+
+func TestCapturer_Busy(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(&fakeReader{}, Config{Dir: dir, BusyFor: time.Minute, MinInterval: 10 * time.Minute}, promslog.NewNopLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	for i, tc := range []struct {
+		after time.Duration
+		info  *collector.Info
+		want  int
+	}{
+		{info: passengertest.Generate(passengertest.Spec{ProcessesPerApp: 2, Sessions: []int{1}}), want: 0},
+		// A process finishing its request restarts the clock.
+		{after: 30 * time.Second, info: passengertest.Generate(passengertest.Spec{ProcessesPerApp: 2, Sessions: []int{1, 0}}), want: 0},
+		{after: 30 * time.Second, info: passengertest.Generate(passengertest.Spec{ProcessesPerApp: 2, Sessions: []int{1}}), want: 0},
+		{after: 59 * time.Second, info: passengertest.Generate(passengertest.Spec{ProcessesPerApp: 2, Sessions: []int{1}}), want: 0},
+		{after: time.Second, info: passengertest.Generate(passengertest.Spec{ProcessesPerApp: 2, Sessions: []int{1}}), want: 1},
+		// Captures are rate limited.
+		{after: time.Minute, info: passengertest.Generate(passengertest.Spec{ProcessesPerApp: 2, Sessions: []int{1}}), want: 1},
+		{after: 9 * time.Minute, info: passengertest.Generate(passengertest.Spec{ProcessesPerApp: 2, Sessions: []int{1}}), want: 2},
+	} {
+		now = now.Add(tc.after)
+		c.Observe(now, tc.info)
+		c.capturing.Wait()
+		if got := len(captures(t, dir)); got != tc.want {
+			t.Errorf("scrape %d: expected %d captures, got %d", i, tc.want, got)
+		}
+	}
+
+	data, err := os.ReadFile(captures(t, dir)[0])
+	if err != nil {
+		t.Fatalf("failed to read capture: %v", err)
+	}
+	want := "# Captured at 2024-05-06T07:10:09Z, condition busy held for /srv/app/app0 (production)\n\nThread 1:\n    in 'block in accept'\n"
+	if string(data) != want {
+		t.Errorf("expected capture %q, got %q", want, string(data))
+	}
+	if got := testutil.ToFloat64(c.captures.WithLabelValues(ReasonBusy)); got != 2 {
+		t.Errorf("expected 2 captures counted, got %v", got)
+	}
+}
+
+func TestCapturer_QueueAndRotation(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(&fakeReader{}, Config{Dir: dir, QueueAbove: 10, Keep: 2}, promslog.NewNopLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	c.Observe(now, passengertest.Generate(passengertest.Spec{AppQueue: 10}))
+	c.capturing.Wait()
+	if got := len(captures(t, dir)); got != 0 {
+		t.Errorf("expected no capture at the queue limit, got %d", got)
+	}
+
+	var want []string
+	for range 3 {
+		now = now.Add(time.Minute)
+		c.Observe(now, passengertest.Generate(passengertest.Spec{AppQueue: 11}))
+		c.capturing.Wait()
+		want = append(want, filepath.Join(dir, "backtraces-"+now.Format(fileTimeFormat)+".txt"))
+	}
+	got := captures(t, dir)
+	if strings.Join(got, ",") != strings.Join(want[1:], ",") {
+		t.Errorf("expected the newest captures %v to be kept, got %v", want[1:], got)
+	}
+	if got := testutil.ToFloat64(c.captures.WithLabelValues(ReasonQueue)); got != 3 {
+		t.Errorf("expected 3 captures counted, got %v", got)
+	}
+}
+
+func TestCapturer_Failure(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(&fakeReader{err: errors.New("unexpected status code 401")}, Config{Dir: dir, QueueAbove: 1}, promslog.NewNopLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c.Observe(time.Now(), passengertest.Generate(passengertest.Spec{AppQueue: 5}))
+	c.capturing.Wait()
+	if got := testutil.ToFloat64(c.failures); got != 1 {
+		t.Errorf("expected 1 failure counted, got %v", got)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read diagnostics directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no file left behind, got %v", entries)
+	}
+}
+
+func TestCapturer_RateLimitedPerApp(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(&fakeReader{}, Config{Dir: dir, QueueAbove: 10, MinInterval: 10 * time.Minute}, promslog.NewNopLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	for i, tc := range []struct {
+		after  time.Duration
+		queues []int
+		want   int
+	}{
+		{queues: []int{11, 0}, want: 1},
+		// The first app keeps its queue, which does not hold up the
+		// captures of the second.
+		{after: time.Minute, queues: []int{11, 0}, want: 1},
+		{after: time.Minute, queues: []int{11, 11}, want: 2},
+		{after: 8 * time.Minute, queues: []int{11, 11}, want: 3},
+	} {
+		info := passengertest.Generate(passengertest.Spec{Apps: 2})
+		for i, queue := range tc.queues {
+			info.SuperGroups[i].RequestsInQueue = strconv.Itoa(queue)
+		}
+		now = now.Add(tc.after)
+		c.Observe(now, info)
+		c.capturing.Wait()
+		if got := len(captures(t, dir)); got != tc.want {
+			t.Errorf("scrape %d: expected %d captures, got %d", i, tc.want, got)
+		}
+	}
+
+	paths := captures(t, dir)
+	data, err := os.ReadFile(paths[len(paths)-1])
+	if err != nil {
+		t.Fatalf("failed to read capture: %v", err)
+	}
+	if want := "# Captured at 2024-05-06T07:18:09Z, condition queue held for /srv/app/app0 (production)\n\n"; !strings.HasPrefix(string(data), want) {
+		t.Errorf("expected capture to start with %q, got %q", want, string(data))
+	}
+}
@@ -14,15 +14,32 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/alecthomas/kingpin/v2"
+	"github.com/nex-health/passenger-exporter/backtraces"
 	"github.com/nex-health/passenger-exporter/collector"
+	"github.com/nex-health/passenger-exporter/events"
+	"github.com/nex-health/passenger-exporter/handler"
+	"github.com/nex-health/passenger-exporter/pushgateway"
+	"github.com/nex-health/passenger-exporter/statsd"
+	"github.com/nex-health/passenger-exporter/textfile"
+	"github.com/nex-health/passenger-exporter/webhook"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/promslog"
 	"github.com/prometheus/common/promslog/flag"
 	"github.com/prometheus/common/version"
@@ -34,9 +51,56 @@ func main() {
 	var (
 		webConfig   = webflag.AddFlags(kingpin.CommandLine, ":9149")
 		metricsPath = kingpin.Flag("web.telemetry-path", "Path under which to expose metrics.").Default("/metrics").String()
+		enableDebug = kingpin.Flag("web.enable-debug-endpoints", "Serve the raw pool.xml and its parsed form under /debug/.").Default("false").Bool()
+		enableAPI   = kingpin.Flag("web.enable-api", "Serve the pool the metrics are exported from as JSON under /api/v1/instances.").Default("false").Bool()
 
 		instanceRegistry = kingpin.Flag("passenger.instance-registry", "Path to the instance registry directory.").Default(os.TempDir()).String()
 		pidFile          = kingpin.Flag("passenger.pid-file", "Optional path to a file containing the passenger/nginx PID for additional metrics.").Default("").String()
+		readInterval     = kingpin.Flag("passenger.read-interval", "Scrapes and pushes within this long of the last pool read reuse it instead of reading pool.xml again. 0 reads it on every scrape and push.").Default("0s").Duration()
+
+		hostnameOverride   = kingpin.Flag("metrics.hostname", "Value of the hostname label. Defaults to $HOSTNAME or the host name reported by the kernel.").Default("").String()
+		hostnameLabel      = kingpin.Flag("metrics.hostname-label", "Add the hostname label to Passenger metrics. Disable with --no-metrics.hostname-label when the instance label already identifies the host.").Default("true").Bool()
+		pidLabels          = kingpin.Flag("metrics.pid-labels", "Add the pid and gupid labels to process metrics.").Default("false").Bool()
+		maxPIDSeries       = kingpin.Flag("metrics.pid-labels-max-series", "Max number of processes exported with PID labels. Past it, processes are only told apart by their slot ID.").Default("1000").Int()
+		maxProcesses       = kingpin.Flag("metrics.max-processes", "Max number of processes exported with their own series. 0 is unlimited.").Default("0").Int()
+		maxProcessesPerApp = kingpin.Flag("metrics.max-processes-per-app", "Max number of processes of an app exported with their own series. 0 is unlimited.").Default("0").Int()
+		processesBy        = kingpin.Flag("metrics.max-processes-by", "Processes using the most of this keep their own series. One of: [memory, sessions]").Default(collector.LimitByMemory).Enum(collector.LimitOrderings...)
+		memoryWindow       = kingpin.Flag("metrics.memory-growth-window", "Window over which the memory growth of processes is fitted. 0 disables memory growth metrics.").Default("0s").Duration()
+		leakThreshold      = kingpin.Flag("metrics.memory-leak-threshold", "Memory growth in bytes per second past which a process counts as leaking.").Default("1024").Float64()
+		stuckThreshold     = kingpin.Flag("metrics.stuck-threshold", "Time a process may have sessions without processing a request before it counts as stuck. 0 disables stuck process metrics.").Default("0s").Duration()
+		logStuck           = kingpin.Flag("metrics.log-stuck-processes", "Log the PID of processes found stuck.").Default("false").Bool()
+		constLabels        = kingpin.Flag("metrics.const-label", "Constant label to add to every metric, as KEY=VALUE. Can be repeated.").PlaceHolder("KEY=VALUE").StringMap()
+
+		appNameSource = kingpin.Flag("app.name-source", "Where the app label is taken from. One of: [name, app_group_name, app_root]").Default(collector.NameSourceName).Enum(collector.NameSources...)
+		appRootNames  = kingpin.Flag("app.root-name", "App label of the app with the given app root, as ROOT=APP. Can be repeated.").PlaceHolder("ROOT=APP").StringMap()
+		appRewrites   = kingpin.Flag("app.rewrite", "Regex replacement applied to app labels in order, as REGEX=REPLACEMENT. Can be repeated.").PlaceHolder("REGEX=REPLACEMENT").Strings()
+
+		backtracesDir         = kingpin.Flag("backtraces.dir", "Optional diagnostics directory to capture the backtraces of Passenger processes to when an app looks stuck.").Default("").String()
+		backtracesBusyFor     = kingpin.Flag("backtraces.busy-for", "Capture when every process of an app has been busy for this long. 0 disables the condition.").Default("2m").Duration()
+		backtracesQueueAbove  = kingpin.Flag("backtraces.queue-above", "Capture when more requests than this wait in the queue of an app. 0 disables the condition.").Default("0").Int()
+		backtracesMinInterval = kingpin.Flag("backtraces.min-interval", "Least time between two captures triggered by the same app.").Default("10m").Duration()
+		backtracesKeep        = kingpin.Flag("backtraces.keep", "Number of captures to keep. 0 keeps all.").Default("10").Int()
+
+		eventsBufferSize = kingpin.Flag("events.buffer-size", "Number of pool events kept for /api/v1/events. 0 disables events.").Default("1000").Int()
+		eventsQueueAbove = kingpin.Flag("events.queue-above", "Report an event when more requests than this wait in the queue of an app. 0 disables queue events.").Default("0").Int()
+
+		adminTokenFile = kingpin.Flag("admin.token-file", "Optional file holding the bearer token that enables the admin endpoints under /api/v1/admin/.").Default("").String()
+		adminDryRun    = kingpin.Flag("admin.dry-run", "Validate and log admin actions without performing them.").Default("false").Bool()
+
+		webhookConfigFile = kingpin.Flag("webhook.config-file", "Optional YAML file of webhooks to notify when conditions on the pool hold for an app.").Default("").String()
+
+		statsdAddress  = kingpin.Flag("statsd.address", "Optional StatsD/DogStatsD address to push metrics to, either udp://host:port or unixgram:///path.").Default("").String()
+		statsdFormat   = kingpin.Flag("statsd.format", "Wire format of pushed metrics. One of: [statsd, dogstatsd]").Default(statsd.FormatDogStatsD).Enum(statsd.FormatStatsD, statsd.FormatDogStatsD)
+		statsdPrefix   = kingpin.Flag("statsd.prefix", "Optional prefix of pushed metric names.").Default("").String()
+		statsdInterval = kingpin.Flag("statsd.interval", "Interval between pushes to StatsD.").Default("15s").Duration()
+
+		pushGatewayURL = kingpin.Flag("push.gateway-url", "Optional Pushgateway URL to push metrics to.").Default("").String()
+		pushJob        = kingpin.Flag("push.job", "Job name to push metrics under.").Default("passenger").String()
+		pushInterval   = kingpin.Flag("push.interval", "Interval between pushes to the Pushgateway.").Default("15s").Duration()
+
+		textfilePath     = kingpin.Flag("textfile.path", "Optional .prom file in the node_exporter textfile directory to write metrics to instead of serving them over HTTP.").Default("").String()
+		textfileInterval = kingpin.Flag("textfile.interval", "Interval between textfile writes. 0 writes once and exits.").Default("0s").Duration()
+		textfileMode     = kingpin.Flag("textfile.mode", "Octal file mode of the textfile.").Default("0644").String()
 	)
 
 	promslogConfig := &promslog.Config{}
@@ -49,17 +113,162 @@ func main() {
 	logger.Info("Starting passenger_exporter", "version", version.Info())
 	logger.Info("Build context", "context", version.BuildContext())
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Push modes are waited for on shutdown so they can clean up.
+	var pushers sync.WaitGroup
+
+	// Push modes only send Passenger metrics, not the exporter's own. They
+	// gather from the default registry, so the collector is registered once
+	// and every pool it reads is observed once.
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := prometheus.DefaultGatherer.Gather()
+		return slices.DeleteFunc(families, func(family *dto.MetricFamily) bool {
+			return !strings.HasPrefix(family.GetName(), "passenger_")
+		}), err
+	})
+
 	if *pidFile != "" {
 		pidCollector := collectors.NewProcessCollector(collectors.ProcessCollectorOpts{
 			PidFn:     prometheus.NewPidFileFn(*pidFile),
 			Namespace: "passenger",
 		})
-		prometheus.MustRegister(pidCollector)
+		// The Passenger collector adds the constant labels itself.
+		if err := prometheus.WrapRegistererWith(*constLabels, prometheus.DefaultRegisterer).Register(pidCollector); err != nil {
+			logger.Error("Error registering process collector, check the constant labels", "err", err)
+			os.Exit(1)
+		}
 	}
 
+	hostname := collector.Hostname()
+	if *hostnameOverride != "" {
+		hostname = *hostnameOverride
+	}
+	namer := collector.AppNamer{Source: *appNameSource, Roots: *appRootNames}
+	for _, s := range *appRewrites {
+		rewrite, err := collector.ParseRewrite(s)
+		if err != nil {
+			logger.Error("Error parsing app label rewrite", "err", err)
+			os.Exit(1)
+		}
+		namer.Rewrites = append(namer.Rewrites, rewrite)
+	}
+	options := []collector.Option{
+		collector.WithLogger(logger),
+		collector.WithReadInterval(*readInterval),
+		collector.WithHostname(hostname),
+		collector.WithConstLabels(*constLabels),
+		collector.WithAppNamer(namer),
+		collector.WithMemoryGrowth(*memoryWindow, *leakThreshold),
+		collector.WithStuckDetection(*stuckThreshold, *logStuck),
+		collector.WithProcessLimits(collector.ProcessLimits{Max: *maxProcesses, MaxPerApp: *maxProcessesPerApp, By: *processesBy}),
+	}
+	if !*hostnameLabel {
+		options = append(options, collector.WithoutHostname())
+	}
+	if *pidLabels {
+		options = append(options, collector.WithPIDLabels(*maxPIDSeries))
+	}
 	udsReader := collector.NewUDSReader(*instanceRegistry)
-	collector := collector.New(udsReader)
-	prometheus.MustRegister(collector)
+	var capturer *backtraces.Capturer
+	if *backtracesDir != "" {
+		var err error
+		capturer, err = backtraces.New(udsReader, backtraces.Config{
+			Dir:         *backtracesDir,
+			BusyFor:     *backtracesBusyFor,
+			QueueAbove:  *backtracesQueueAbove,
+			MinInterval: *backtracesMinInterval,
+			Keep:        *backtracesKeep,
+		}, logger)
+		if err != nil {
+			logger.Error("Error creating backtraces capturer", "err", err)
+			os.Exit(1)
+		}
+		options = append(options, collector.WithObserver(capturer))
+	}
+	var eventLog *events.Log
+	if *eventsBufferSize > 0 {
+		// Events are logged as JSON whatever the log format, to be picked up
+		// by log pipelines.
+		format := promslog.NewFormat()
+		format.Set("json")
+		eventLog = events.New(*eventsBufferSize, *eventsQueueAbove, namer, promslog.New(&promslog.Config{Level: promslogConfig.Level, Format: format}))
+		options = append(options, collector.WithObserver(eventLog))
+	}
+	if *webhookConfigFile != "" {
+		config, err := webhook.LoadConfig(*webhookConfigFile)
+		if err != nil {
+			logger.Error("Error loading webhook config", "err", err)
+			os.Exit(1)
+		}
+		notifier, err := webhook.New(ctx, config, logger)
+		if err != nil {
+			logger.Error("Error creating webhook notifier", "err", err)
+			os.Exit(1)
+		}
+		// Notifications being sent are waited for on shutdown, retries
+		// stop once ctx is done.
+		defer notifier.Wait()
+		options = append(options, collector.WithObserver(notifier))
+	}
+	collector := collector.New(udsReader, options...)
+	if err := prometheus.Register(collector); err != nil {
+		logger.Error("Error registering collector, check the constant labels", "err", err)
+		os.Exit(1)
+	}
+	if capturer != nil {
+		prometheus.WrapRegistererWith(collector.ConstLabels(), prometheus.DefaultRegisterer).MustRegister(capturer)
+	}
+
+	if *statsdAddress != "" {
+		statsdClient, err := statsd.New(gatherer, statsd.Config{
+			Address: *statsdAddress,
+			Format:  *statsdFormat,
+			Prefix:  *statsdPrefix,
+		})
+		if err != nil {
+			logger.Error("Error creating statsd client", "err", err)
+			os.Exit(1)
+		}
+		defer statsdClient.Close()
+		pushers.Go(func() { statsdClient.Run(ctx, *statsdInterval, logger) })
+	}
+
+	if *pushGatewayURL != "" {
+		// The hostname label is taken by the metrics themselves unless dropped.
+		pusher := pushgateway.New(*pushGatewayURL, *pushJob, gatherer, func() (map[string]string, error) {
+			instance, err := udsReader.Instance()
+			if err != nil {
+				return nil, err
+			}
+			return map[string]string{"instance": hostname, "passenger_instance": instance}, nil
+		})
+		pushers.Go(func() { pusher.Run(ctx, *pushInterval, logger) })
+	}
+
+	if *textfilePath != "" {
+		if filepath.Ext(*textfilePath) != ".prom" {
+			logger.Error("Textfile must have the .prom extension to be read by node_exporter", "path", *textfilePath)
+			os.Exit(1)
+		}
+		mode, err := strconv.ParseUint(*textfileMode, 8, 32)
+		if err != nil {
+			logger.Error("Error parsing textfile mode", "mode", *textfileMode, "err", err)
+			os.Exit(1)
+		}
+
+		if *textfileInterval == 0 {
+			if err := textfile.Write(gatherer, *textfilePath, os.FileMode(mode)); err != nil {
+				logger.Error("Error writing textfile", "path", *textfilePath, "err", err)
+				os.Exit(1)
+			}
+			return
+		}
+		textfile.Run(ctx, gatherer, *textfilePath, os.FileMode(mode), *textfileInterval, logger)
+		pushers.Wait()
+		return
+	}
 
 	http.Handle(*metricsPath, promhttp.Handler())
 
@@ -75,12 +284,49 @@ func main() {
 		},
 		ExtraHTML: fmt.Sprintf(`<h2>Options</h2><pre>passenger.instance-registry: "%s", passenger.pid-file: "%s"</pre>`, *instanceRegistry, *pidFile),
 	}
-	landingHandler, err := web.NewLandingPage(landingConfig)
-	if err != nil {
+	if *enableDebug {
+		http.Handle("/debug/pool.xml", handler.PoolXML(udsReader))
+		http.Handle("/debug/pool.json", handler.PoolJSON(udsReader))
+		landingConfig.Links = append(landingConfig.Links,
+			web.LandingLinks{Address: "/debug/pool.xml", Text: "pool.xml", Description: "Raw pool.xml from the Passenger core API"},
+			web.LandingLinks{Address: "/debug/pool.json", Text: "pool.json", Description: "Parsed pool.xml with secrets redacted"},
+		)
+	}
+	if eventLog != nil {
+		http.Handle("/api/v1/events", handler.Events(eventLog))
+		landingConfig.Links = append(landingConfig.Links,
+			web.LandingLinks{Address: "/api/v1/events", Text: "Events", Description: "Latest changes of the Passenger pool"},
+		)
+	}
+	if *enableAPI {
+		api := handler.API(collector, udsReader.Instance, namer)
+		http.Handle("/api/v1/instances", api)
+		http.Handle("/api/v1/instances/", api)
+		landingConfig.Links = append(landingConfig.Links,
+			web.LandingLinks{Address: "/api/v1/instances", Text: "Instances", Description: "Pool of the Passenger instance as JSON"},
+		)
+	}
+	if *adminTokenFile != "" {
+		data, err := os.ReadFile(*adminTokenFile)
+		if err != nil {
+			logger.Error("Error reading admin token", "err", err)
+			os.Exit(1)
+		}
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			logger.Error("Empty admin token", "path", *adminTokenFile)
+			os.Exit(1)
+		}
+		http.Handle("/api/v1/admin/", handler.Admin(udsReader, handler.AdminConfig{
+			Token:  token,
+			DryRun: *adminDryRun,
+		}, logger))
+	}
+	if _, err := web.NewLandingPage(landingConfig); err != nil {
 		logger.Error("Error creating landing page", "err", err)
 		os.Exit(1)
 	}
-	http.Handle("/", landingHandler)
+	http.Handle("/", handler.Status(landingConfig, udsReader, collector))
 	http.HandleFunc("/-/healthy", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "OK")
@@ -91,8 +337,14 @@ func main() {
 	})
 
 	srv := &http.Server{}
-	if err := web.ListenAndServe(srv, webConfig, logger); err != nil {
+	go func() {
+		<-ctx.Done()
+		logger.Info("Shutting down")
+		srv.Shutdown(context.Background())
+	}()
+	if err := web.ListenAndServe(srv, webConfig, logger); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		logger.Error("Error starting HTTP server", "err", err)
 		os.Exit(1)
 	}
+	pushers.Wait()
 }
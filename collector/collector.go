@@ -16,11 +16,17 @@
 package collector
 
 import (
+	"errors"
+	"log/slog"
+	"maps"
 	"math"
 	"os"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/promslog"
 )
 
 const (
@@ -29,80 +35,418 @@ const (
 	nanosecondsPerSecond = 1000000000
 )
 
-var (
-	up = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "up"),
-		"Passenger state.",
-		[]string{"hostname"}, nil,
-	)
-	version = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "version"),
-		"Phusion Passenger version.",
-		[]string{"version", "hostname"}, nil,
-	)
-	toplevelQueue = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "top_level_queue"),
-		"Number of requests in the top-level queue.",
-		[]string{"hostname"}, nil,
-	)
-	maxProcessCount = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "max_processes"),
-		"Configured maximum number of processes.",
-		[]string{"hostname"}, nil,
-	)
-	currentProcessCount = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "current_processes"),
-		"Current number of processes.",
-		[]string{"hostname"}, nil,
-	)
-	appCount = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "app_count"),
-		"Number of apps.",
-		[]string{"hostname"}, nil,
-	)
-	appQueue = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "app_queue"),
-		"Number of requests in app process queues.",
-		[]string{"name", "hostname"}, nil,
-	)
-	appGroupQueue = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "app_group_queue"),
-		"Number of requests in app group process queues.",
-		[]string{"group", "default", "hostname"}, nil,
-	)
-	appProcsSpawning = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "app_procs_spawning"),
-		"Number of processes spawning.",
-		[]string{"name", "hostname"}, nil,
-	)
-	requestsProcessed = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "requests_processed_total"),
-		"Number of processes served by a process.",
-		[]string{"name", "id", "hostname"}, nil,
-	)
-	sessions = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "current_sessions"),
-		"Number of sessions currently being handled by a process.",
-		[]string{"name", "id", "hostname"}, nil,
-	)
-	procStartTime = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "proc_start_time_seconds"),
-		"Number of seconds since processor started.",
-		[]string{"name", "id", "hostname"}, nil,
-	)
-	procMemory = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "proc_memory"),
-		"Memory consumed by a process",
-		[]string{"name", "id", "hostname"}, nil,
-	)
-)
+// queueDepthBuckets are the upper bounds of the queue depth histogram
+// buckets. Passenger rejects requests beyond 100 queued by default.
+var queueDepthBuckets = []float64{0, 1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+
+// descs are the descriptions of the metrics, which carry the constant labels
+// of a Collector.
+type descs struct {
+	up                           *prometheus.Desc
+	version                      *prometheus.Desc
+	toplevelQueue                *prometheus.Desc
+	maxProcessCount              *prometheus.Desc
+	currentProcessCount          *prometheus.Desc
+	appCount                     *prometheus.Desc
+	appQueue                     *prometheus.Desc
+	appGroupQueue                *prometheus.Desc
+	appProcsSpawning             *prometheus.Desc
+	appGroupRestarting           *prometheus.Desc
+	appGroupRestartsInitiated    *prometheus.Desc
+	appGroupDetachedProcesses    *prometheus.Desc
+	appGroupRestartProgress      *prometheus.Desc
+	appGroupSpawnerPresent       *prometheus.Desc
+	appGroupSpawnerAge           *prometheus.Desc
+	appGroupSpawnerRecreations   *prometheus.Desc
+	appGroupSpawnMethod          *prometheus.Desc
+	appGroupMaxPreloaderIdleTime *prometheus.Desc
+	queueRequests                *prometheus.Desc
+	queueSaturation              *prometheus.Desc
+	appGroupStickyWorkers        *prometheus.Desc
+	appGroupStickyMaxSessions    *prometheus.Desc
+	appGroupStickyMaxShare       *prometheus.Desc
+	requestsProcessed            *prometheus.Desc
+	sessions                     *prometheus.Desc
+	procStartTime                *prometheus.Desc
+	procMemory                   *prometheus.Desc
+	pidLabelsDropped             *prometheus.Desc
+	procFolded                   *prometheus.Desc
+	procMemoryGrowth             *prometheus.Desc
+	appLeakingWorkers            *prometheus.Desc
+	procStuck                    *prometheus.Desc
+	appStuckProcesses            *prometheus.Desc
+}
+
+// newDescs returns the descs of the collector, process metrics having
+// procLabels.
+func newDescs(constLabels prometheus.Labels, procLabels []string) descs {
+	return descs{
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "up"),
+			"Passenger state.",
+			nil, constLabels,
+		),
+		version: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "version"),
+			"Phusion Passenger version.",
+			[]string{"version"}, constLabels,
+		),
+		toplevelQueue: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "top_level_queue"),
+			"Number of requests in the top-level queue.",
+			nil, constLabels,
+		),
+		maxProcessCount: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "max_processes"),
+			"Configured maximum number of processes.",
+			nil, constLabels,
+		),
+		currentProcessCount: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "current_processes"),
+			"Current number of processes.",
+			nil, constLabels,
+		),
+		appCount: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_count"),
+			"Number of apps.",
+			nil, constLabels,
+		),
+		appQueue: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_queue"),
+			"Number of requests in app process queues.",
+			[]string{"name", "app", "environment"}, constLabels,
+		),
+		appGroupQueue: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_group_queue"),
+			"Number of requests in app group process queues.",
+			[]string{"group", "app", "environment", "component", "default"}, constLabels,
+		),
+		appProcsSpawning: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_procs_spawning"),
+			"Number of processes spawning, summed over the groups of an app.",
+			[]string{"name", "app", "environment"}, constLabels,
+		),
+		appGroupRestarting: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_group_restarting"),
+			"Whether a rolling restart of the app group is in progress.",
+			[]string{"name", "app", "environment", "component"}, constLabels,
+		),
+		appGroupRestartsInitiated: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_group_restarts_initiated_total"),
+			"Number of rolling restarts of the app group initiated.",
+			[]string{"name", "app", "environment", "component"}, constLabels,
+		),
+		appGroupDetachedProcesses: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_group_detached_processes"),
+			"Number of processes detached by a rolling restart that are still shutting down.",
+			[]string{"name", "app", "environment", "component"}, constLabels,
+		),
+		appGroupRestartProgress: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_group_restart_progress_ratio"),
+			"Share of the processes of the app group replaced by the rolling restart in progress, 1 if there is none.",
+			[]string{"name", "app", "environment", "component"}, constLabels,
+		),
+		appGroupSpawnerPresent: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_group_spawner_present"),
+			"Whether the app group has a preloader, estimated from its spawn method, last spawn and max preloader idle time.",
+			[]string{"name", "app", "environment", "component"}, constLabels,
+		),
+		appGroupSpawnerAge: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_group_spawner_age_seconds"),
+			"Seconds since the newest spawner of the app group's processes was created.",
+			[]string{"name", "app", "environment", "component"}, constLabels,
+		),
+		appGroupSpawnerRecreations: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_group_spawner_recreations_total"),
+			"Number of spawner recreations observed for the app group.",
+			[]string{"name", "app", "environment", "component"}, constLabels,
+		),
+		appGroupSpawnMethod: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_group_spawn_method_info"),
+			"Spawn method configured for the app group.",
+			[]string{"name", "app", "environment", "component", "method"}, constLabels,
+		),
+		appGroupMaxPreloaderIdleTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_group_max_preloader_idle_time_seconds"),
+			"Seconds a preloader may idle before it is shut down, 0 for never.",
+			[]string{"name", "app", "environment", "component"}, constLabels,
+		),
+		queueRequests: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "queue_requests"),
+			"Number of requests waiting in a queue, by queue level: toplevel, supergroup (app), group or disable.",
+			[]string{"level", "name", "app", "environment", "component"}, constLabels,
+		),
+		queueSaturation: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "queue_saturation_ratio"),
+			"Requests waiting in the queue of an app group relative to its max request queue size.",
+			[]string{"name", "app", "environment", "component"}, constLabels,
+		),
+		appGroupStickyWorkers: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_group_sticky_workers"),
+			"Number of distinct sticky session IDs of the processes of an app group using sticky sessions.",
+			[]string{"name", "app", "environment", "component"}, constLabels,
+		),
+		appGroupStickyMaxSessions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_group_sticky_max_sessions"),
+			"Most sessions handled under one sticky session ID of an app group using sticky sessions.",
+			[]string{"name", "app", "environment", "component"}, constLabels,
+		),
+		appGroupStickyMaxShare: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_group_sticky_max_session_share"),
+			"Share of the sessions of an app group using sticky sessions handled under its busiest sticky session ID.",
+			[]string{"name", "app", "environment", "component"}, constLabels,
+		),
+		requestsProcessed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "requests_processed_total"),
+			"Number of processes served by a process.",
+			procLabels, constLabels,
+		),
+		sessions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "current_sessions"),
+			"Number of sessions currently being handled by a process.",
+			procLabels, constLabels,
+		),
+		procStartTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "proc_start_time_seconds"),
+			"Number of seconds since processor started.",
+			procLabels, constLabels,
+		),
+		procMemory: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "proc_memory"),
+			"Memory consumed by a process",
+			procLabels, constLabels,
+		),
+		pidLabelsDropped: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "proc_pid_labels_dropped"),
+			"Number of processes exported with slot IDs instead of PID labels because there are more processes than allowed.",
+			nil, constLabels,
+		),
+		procFolded: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "proc_folded"),
+			"Number of processes of an app group past the process limits, exported together with the \"other\" ID.",
+			[]string{"name", "app", "environment", "component"}, constLabels,
+		),
+		procMemoryGrowth: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "proc_memory_growth_bytes_per_second"),
+			"Growth rate of the memory of a process over the memory growth window, fitted by linear regression.",
+			procLabels, constLabels,
+		),
+		appLeakingWorkers: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_leaking_workers"),
+			"Number of processes of an app whose memory grows faster than the leak threshold.",
+			[]string{"name", "app", "environment"}, constLabels,
+		),
+		procStuck: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "proc_stuck"),
+			"Whether a process has had sessions without processing a request for the stuck threshold.",
+			procLabels, constLabels,
+		),
+		appStuckProcesses: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "app_stuck_processes"),
+			"Number of stuck processes of an app.",
+			[]string{"name", "app", "environment"}, constLabels,
+		),
+	}
+}
 
 type Collector struct {
 	reader   MetricsReader
 	hostname string
+	logger   *slog.Logger
+
+	// dropHostname leaves the hostname label out, constLabels are added to
+	// every metric on top of it.
+	dropHostname bool
+	constLabels  prometheus.Labels
+	desc         descs
+	names        AppNamer
+
+	// pidLabels adds the pid and gupid labels to process metrics as long as
+	// there are at most maxPIDSeries processes.
+	pidLabels    bool
+	maxPIDSeries int
+
+	limits ProcessLimits
+
+	observers []Observer
+
+	// collectMu guards reading a new pool into last, which is emitted again
+	// by Collects within readInterval of its read.
+	collectMu    sync.Mutex
+	last         *snapshot
+	readInterval time.Duration
+
+	// memory holds the memory samples of every process by PID over
+	// memoryWindow.
+	memory        map[string][]memorySample
+	memoryWindow  time.Duration
+	leakThreshold float64
+
+	// progress holds the progress of every process by PID, to tell stuck
+	// processes.
+	progress       map[string]*processProgress
+	stuckThreshold time.Duration
+	logStuck       bool
+
+	mu            sync.Mutex
+	lastScrape    time.Time
+	lastScrapeErr error
+	// unknownSchema is the last unknown schema version warned about.
+	unknownSchema string
+	// groups holds the state of every group by name.
+	groups map[string]*groupState
+	now    func() time.Time
+
+	queueDepth *prometheus.HistogramVec
 }
 
-func New(reader MetricsReader) *Collector {
+// Option configures a Collector.
+type Option func(*Collector)
+
+// Observer is told about every pool the collector reads, e.g. to act on its
+// state. Observe must not modify info.
+type Observer interface {
+	Observe(at time.Time, info *Info)
+}
+
+// WithObserver passes every pool the collector reads to observer, in the order
+// observers were added.
+func WithObserver(observer Observer) Option {
+	return func(c *Collector) {
+		c.observers = append(c.observers, observer)
+	}
+}
+
+// WithReadInterval emits the last pool read again on Collects within interval
+// of its read, instead of reading Passenger once per Collect, so scrapes and
+// pushes close together share a read.
+func WithReadInterval(interval time.Duration) Option {
+	return func(c *Collector) {
+		c.readInterval = interval
+	}
+}
+
+// WithLogger makes the collector log to logger instead of discarding its
+// log messages.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Collector) {
+		c.logger = logger
+	}
+}
+
+// WithHostname sets the value of the hostname label instead of taking it
+// from the environment.
+func WithHostname(hostname string) Option {
+	return func(c *Collector) {
+		c.hostname = hostname
+	}
+}
+
+// WithoutHostname leaves the hostname label out of every metric, for when the
+// instance label of the target already identifies the host.
+func WithoutHostname() Option {
+	return func(c *Collector) {
+		c.dropHostname = true
+	}
+}
+
+// WithConstLabels adds labels with constant values, such as the datacenter
+// or the role of the host, to every metric. They take precedence over the
+// hostname label.
+func WithConstLabels(labels prometheus.Labels) Option {
+	return func(c *Collector) {
+		maps.Copy(c.constLabels, labels)
+	}
+}
+
+// WithAppNamer derives the app and environment labels with namer.
+func WithAppNamer(namer AppNamer) Option {
+	return func(c *Collector) {
+		c.names = namer
+	}
+}
+
+// WithPIDLabels adds the pid and gupid labels to process metrics, to correlate
+// them with logs and other tools. Past maxSeries processes, the labels are left
+// empty and processes are told apart by their slot ID alone.
+func WithPIDLabels(maxSeries int) Option {
+	return func(c *Collector) {
+		c.pidLabels = true
+		c.maxPIDSeries = maxSeries
+	}
+}
+
+// WithProcessLimits caps the number of processes exported with their own
+// series.
+func WithProcessLimits(limits ProcessLimits) Option {
+	return func(c *Collector) {
+		c.limits = limits
+	}
+}
+
+// WithMemoryGrowth exports the memory growth rate of processes over window
+// and counts the ones of every app growing faster than threshold bytes per
+// second as leaking.
+func WithMemoryGrowth(window time.Duration, threshold float64) Option {
+	return func(c *Collector) {
+		c.memoryWindow = window
+		c.leakThreshold = threshold
+	}
+}
+
+// WithStuckDetection flags processes that have had sessions without processing
+// a request for threshold as stuck, logging their PID if logPIDs is set.
+func WithStuckDetection(threshold time.Duration, logPIDs bool) Option {
+	return func(c *Collector) {
+		c.stuckThreshold = threshold
+		c.logStuck = logPIDs
+	}
+}
+
+func New(reader MetricsReader, options ...Option) *Collector {
+	c := &Collector{
+		reader:      reader,
+		hostname:    Hostname(),
+		logger:      promslog.NewNopLogger(),
+		constLabels: prometheus.Labels{},
+		groups:      make(map[string]*groupState),
+		memory:      make(map[string][]memorySample),
+		progress:    make(map[string]*processProgress),
+		now:         time.Now,
+	}
+	for _, option := range options {
+		option(c)
+	}
+
+	constLabels := c.ConstLabels()
+	procLabels := []string{"name", "app", "environment", "component", "id"}
+	if c.pidLabels {
+		procLabels = append(procLabels, "pid", "gupid")
+	}
+	c.desc = newDescs(constLabels, procLabels)
+	c.queueDepth = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   namespace,
+		Name:        "queue_depth_requests",
+		Help:        "Number of requests waiting in a queue as observed on every read, by queue level.",
+		Buckets:     queueDepthBuckets,
+		ConstLabels: constLabels,
+	}, []string{"level", "name", "app", "environment", "component"})
+	return c
+}
+
+// ConstLabels returns the labels added to every metric of the collector.
+func (c *Collector) ConstLabels() prometheus.Labels {
+	labels := prometheus.Labels{}
+	if !c.dropHostname {
+		labels["hostname"] = c.hostname
+	}
+	maps.Copy(labels, c.constLabels)
+	return labels
+}
+
+// Hostname returns the value of the hostname label, taken from $HOSTNAME and
+// falling back to the kernel reported host name.
+func Hostname() string {
 	hostname, ok := os.LookupEnv("HOSTNAME")
 	if !ok {
 		var err error
@@ -111,73 +455,377 @@ func New(reader MetricsReader) *Collector {
 			hostname = ""
 		}
 	}
+	return hostname
+}
 
-	return &Collector{reader: reader, hostname: hostname}
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc.up
+	ch <- c.desc.version
+	ch <- c.desc.toplevelQueue
+	ch <- c.desc.maxProcessCount
+	ch <- c.desc.currentProcessCount
+	ch <- c.desc.appCount
+	ch <- c.desc.appQueue
+	ch <- c.desc.appGroupQueue
+	ch <- c.desc.appProcsSpawning
+	ch <- c.desc.appGroupRestarting
+	ch <- c.desc.appGroupRestartsInitiated
+	ch <- c.desc.appGroupDetachedProcesses
+	ch <- c.desc.appGroupRestartProgress
+	ch <- c.desc.appGroupSpawnerPresent
+	ch <- c.desc.appGroupSpawnerAge
+	ch <- c.desc.appGroupSpawnerRecreations
+	ch <- c.desc.appGroupSpawnMethod
+	ch <- c.desc.appGroupMaxPreloaderIdleTime
+	ch <- c.desc.appGroupStickyWorkers
+	ch <- c.desc.appGroupStickyMaxSessions
+	ch <- c.desc.appGroupStickyMaxShare
+	ch <- c.desc.queueRequests
+	ch <- c.desc.queueSaturation
+	c.queueDepth.Describe(ch)
+	ch <- c.desc.requestsProcessed
+	ch <- c.desc.sessions
+	ch <- c.desc.procStartTime
+	ch <- c.desc.procMemory
+	ch <- c.desc.pidLabelsDropped
+	ch <- c.desc.procFolded
+	ch <- c.desc.procMemoryGrowth
+	ch <- c.desc.appLeakingWorkers
+	ch <- c.desc.procStuck
+	ch <- c.desc.appStuckProcesses
 }
 
-func (c Collector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- up
-	ch <- version
-	ch <- toplevelQueue
-	ch <- maxProcessCount
-	ch <- currentProcessCount
-	ch <- appCount
-	ch <- appQueue
-	ch <- appGroupQueue
-	ch <- appProcsSpawning
-	ch <- requestsProcessed
-	ch <- sessions
-	ch <- procStartTime
-	ch <- procMemory
+// snapshot is a pool read from Passenger together with what the collector
+// derived from it and the state it remembers. It is emitted by every Collect
+// until the next read.
+type snapshot struct {
+	info *Info
+	at   time.Time
+
+	folded map[processKey]bool
+	// pidLabelsDropped is the number of processes exported without PID
+	// labels, withPIDs whether there are none.
+	pidLabelsDropped int
+	withPIDs         bool
+
+	growth map[string]float64
+	stuck  map[string]bool
+	// groups holds the stats of every group by name.
+	groups map[string]groupStats
 }
 
-// Mostly copied from https://github.com/stuartnelson3/passenger_exporter/blob/80b16566cdab445f6e68f967019a95b67f608aca/main.go
-func (c Collector) Collect(ch chan<- prometheus.Metric) {
-	var processIdentifiers map[string]int
-	data, err := c.reader.Read()
+// Collect emits the last pool read if it is more recent than the read
+// interval, reading a new one otherwise. Reads are serialized, so observers
+// see pools in the order they were read and each pool is observed once.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	snap, err := c.latest()
 	if err != nil {
-		ch <- prometheus.NewInvalidMetric(prometheus.NewDesc(prometheus.BuildFQName(namespace, "read", "error"), "Error reading metrics data.", nil, nil), err)
+		var readErr *readError
+		errors.As(err, &readErr)
+		ch <- prometheus.NewInvalidMetric(readErr.desc, readErr.err)
 		return
 	}
+	c.emit(ch, snap)
+}
+
+// Pool returns the pool the metrics are exported from and when it was read,
+// reading a new one like Collect if it is older than the read interval. The
+// pool only has the fields ParseStream materializes and must not be modified.
+func (c *Collector) Pool() (*Info, time.Time, error) {
+	snap, err := c.latest()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return snap.info, snap.at, nil
+}
+
+// latest returns the last pool read if it is more recent than the read
+// interval, reading a new one otherwise.
+func (c *Collector) latest() (*snapshot, error) {
+	c.collectMu.Lock()
+	defer c.collectMu.Unlock()
+	if c.last != nil && c.now().Sub(c.last.at) < c.readInterval {
+		return c.last, nil
+	}
+	snap, err := c.read()
+	c.last = snap
+	return snap, err
+}
+
+// readError is a failure to read or parse the pool, reported by Collect as
+// an invalid metric of desc.
+type readError struct {
+	desc *prometheus.Desc
+	err  error
+}
+
+func (e *readError) Error() string { return e.err.Error() }
+
+func (e *readError) Unwrap() error { return e.err }
+
+// read reads and parses the pool, passes it to the observers and updates
+// the state the collector remembers about it.
+func (c *Collector) read() (*snapshot, error) {
+	data, err := c.reader.Read()
+	if err != nil {
+		c.recordScrape(err)
+		return nil, &readError{prometheus.NewDesc(prometheus.BuildFQName(namespace, "read", "error"), "Error reading metrics data.", nil, nil), err}
+	}
 	defer data.Close()
 
-	info, err := Parse(data)
+	info, err := ParseStream(data)
 	if err != nil {
-		ch <- prometheus.NewInvalidMetric(prometheus.NewDesc(prometheus.BuildFQName(namespace, "parse", "error"), "Error parsing metrics data.", nil, nil), err)
-		return
+		c.recordScrape(err)
+		return nil, &readError{prometheus.NewDesc(prometheus.BuildFQName(namespace, "parse", "error"), "Error parsing metrics data.", nil, nil), err}
+	}
+	c.recordScrape(nil)
+	if !KnownSchema(info.SchemaVersion) {
+		c.warnUnknownSchema(info)
+	}
+	now := c.now()
+	for _, observer := range c.observers {
+		observer.Observe(now, info)
 	}
 
-	ch <- prometheus.MustNewConstMetric(up, prometheus.GaugeValue, 1, c.hostname)
+	snap := &snapshot{
+		info:   info,
+		at:     now,
+		folded: c.limits.fold(info),
+		growth: c.observeMemory(info, now),
+		stuck:  c.observeStuck(info, now),
+		groups: make(map[string]groupStats),
+	}
+	if processes := processCount(info) - len(snap.folded); c.pidLabels && processes > c.maxPIDSeries {
+		snap.pidLabelsDropped = processes
+	}
+	snap.withPIDs = c.pidLabels && snap.pidLabelsDropped == 0
 
-	ch <- prometheus.MustNewConstMetric(version, prometheus.GaugeValue, 1, info.PassengerVersion, c.hostname)
+	c.observeQueue("toplevel", "", "", "", "", info.TopLevelRequestsInQueue)
+	groups := make(map[string]bool)
+	for _, sg := range info.SuperGroups {
+		app, environment := c.names.Name(&sg)
+		c.observeQueue("supergroup", sg.Name, app, environment, "", sg.RequestsInQueue)
+		for _, group := range sg.Groups {
+			c.observeQueue("group", sg.Name, app, environment, group.ComponentName, group.GetWaitListSize)
+			c.observeQueue("disable", sg.Name, app, environment, group.ComponentName, group.DisableWaitListSize)
+			groups[group.Name] = true
+			snap.groups[group.Name] = c.observeGroup(sg.Name, &group)
+		}
+	}
+	c.forgetGroups(groups)
+	return snap, nil
+}
 
-	ch <- prometheus.MustNewConstMetric(toplevelQueue, prometheus.GaugeValue, parseFloat(info.TopLevelRequestsInQueue), c.hostname)
-	ch <- prometheus.MustNewConstMetric(maxProcessCount, prometheus.GaugeValue, parseFloat(info.MaxProcessCount), c.hostname)
-	ch <- prometheus.MustNewConstMetric(currentProcessCount, prometheus.GaugeValue, parseFloat(info.CurrentProcessCount), c.hostname)
-	ch <- prometheus.MustNewConstMetric(appCount, prometheus.GaugeValue, parseFloat(info.AppCount), c.hostname)
+// Mostly copied from https://github.com/stuartnelson3/passenger_exporter/blob/80b16566cdab445f6e68f967019a95b67f608aca/main.go
+// emit exports snap.
+func (c *Collector) emit(ch chan<- prometheus.Metric, snap *snapshot) {
+	var processIdentifiers map[string]int
+	info, now := snap.info, snap.at
+
+	ch <- prometheus.MustNewConstMetric(c.desc.up, prometheus.GaugeValue, 1)
+
+	ch <- prometheus.MustNewConstMetric(c.desc.version, prometheus.GaugeValue, 1, info.PassengerVersion)
+
+	ch <- prometheus.MustNewConstMetric(c.desc.toplevelQueue, prometheus.GaugeValue, parseFloat(info.TopLevelRequestsInQueue))
+	ch <- prometheus.MustNewConstMetric(c.desc.maxProcessCount, prometheus.GaugeValue, parseFloat(info.MaxProcessCount))
+	ch <- prometheus.MustNewConstMetric(c.desc.currentProcessCount, prometheus.GaugeValue, parseFloat(info.CurrentProcessCount))
+	ch <- prometheus.MustNewConstMetric(c.desc.appCount, prometheus.GaugeValue, parseFloat(info.AppCount))
+	c.collectQueue(ch, "toplevel", "", "", "", "", info.TopLevelRequestsInQueue)
+	if c.pidLabels {
+		ch <- prometheus.MustNewConstMetric(c.desc.pidLabelsDropped, prometheus.GaugeValue, float64(snap.pidLabelsDropped))
+	}
 
 	for _, sg := range info.SuperGroups {
-		ch <- prometheus.MustNewConstMetric(appQueue, prometheus.GaugeValue, parseFloat(sg.RequestsInQueue), sg.Name, c.hostname)
-		ch <- prometheus.MustNewConstMetric(appProcsSpawning, prometheus.GaugeValue, parseFloat(sg.Group.ProcessesSpawning), sg.Name, c.hostname)
-
-		ch <- prometheus.MustNewConstMetric(appGroupQueue, prometheus.GaugeValue, parseFloat(sg.Group.GetWaitListSize), sg.Group.Name, sg.Group.Default, c.hostname)
-
-		// Update process identifiers map.
-		processIdentifiers := updateProcesses(processIdentifiers, sg.Group.Processes)
-		for _, proc := range sg.Group.Processes {
-			if bucketID, ok := processIdentifiers[proc.PID]; ok {
-				ch <- prometheus.MustNewConstMetric(procMemory, prometheus.GaugeValue, parseFloat(proc.RealMemory), sg.Name, strconv.Itoa(bucketID), c.hostname)
-				ch <- prometheus.MustNewConstMetric(requestsProcessed, prometheus.CounterValue, parseFloat(proc.RequestsProcessed), sg.Name, strconv.Itoa(bucketID), c.hostname)
-				ch <- prometheus.MustNewConstMetric(sessions, prometheus.GaugeValue, parseFloat(proc.Sessions), sg.Name, strconv.Itoa(bucketID), c.hostname)
-
-				if startTime, err := strconv.Atoi(proc.SpawnStartTime); err == nil {
-					ch <- prometheus.MustNewConstMetric(procStartTime, prometheus.GaugeValue, float64(startTime/nanosecondsPerSecond),
-						sg.Name, strconv.Itoa(bucketID), c.hostname,
-					)
+		app, environment := c.names.Name(&sg)
+		ch <- prometheus.MustNewConstMetric(c.desc.appQueue, prometheus.GaugeValue, parseFloat(sg.RequestsInQueue), sg.Name, app, environment)
+		c.collectQueue(ch, "supergroup", sg.Name, app, environment, "", sg.RequestsInQueue)
+
+		// Older Passengers report a group per component of an app, e.g. a
+		// web frontend and background workers, of which one is the default.
+		var spawning, leaking, stuckProcesses float64
+		for _, group := range sg.Groups {
+			spawning += parseFloat(group.ProcessesSpawning)
+
+			ch <- prometheus.MustNewConstMetric(c.desc.appGroupQueue, prometheus.GaugeValue, parseFloat(group.GetWaitListSize), group.Name, app, environment, group.ComponentName, group.Default)
+
+			c.collectQueue(ch, "group", sg.Name, app, environment, group.ComponentName, group.GetWaitListSize)
+			c.collectQueue(ch, "disable", sg.Name, app, environment, group.ComponentName, group.DisableWaitListSize)
+			if maxQueue := parseFloat(group.Options.MaxRequestQueueSize); maxQueue > 0 {
+				ch <- prometheus.MustNewConstMetric(c.desc.queueSaturation, prometheus.GaugeValue, parseFloat(group.GetWaitListSize)/maxQueue, sg.Name, app, environment, group.ComponentName)
+			}
+
+			stats := snap.groups[group.Name]
+			// Only Passenger Enterprise reports rolling restarts.
+			if group.Restarting != "" {
+				restarting := 0.0
+				if group.Restarting == "true" {
+					restarting = 1
 				}
+				ch <- prometheus.MustNewConstMetric(c.desc.appGroupRestarting, prometheus.GaugeValue, restarting, sg.Name, app, environment, group.ComponentName)
+				ch <- prometheus.MustNewConstMetric(c.desc.appGroupRestartsInitiated, prometheus.CounterValue, parseFloat(group.RestartsInitiated), sg.Name, app, environment, group.ComponentName)
+				ch <- prometheus.MustNewConstMetric(c.desc.appGroupDetachedProcesses, prometheus.GaugeValue, float64(len(group.DetachedProcesses)), sg.Name, app, environment, group.ComponentName)
+				ch <- prometheus.MustNewConstMetric(c.desc.appGroupRestartProgress, prometheus.GaugeValue, stats.restartProgress, sg.Name, app, environment, group.ComponentName)
 			}
+
+			present := 0.0
+			if spawnerPresent(&group, now) {
+				present = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.desc.appGroupSpawnerPresent, prometheus.GaugeValue, present, sg.Name, app, environment, group.ComponentName)
+			if created := newest(group.Processes, func(p *Process) string { return p.SpawnerCreationTime }); created != 0 {
+				ch <- prometheus.MustNewConstMetric(c.desc.appGroupSpawnerAge, prometheus.GaugeValue, now.Sub(time.UnixMicro(created)).Seconds(), sg.Name, app, environment, group.ComponentName)
+			}
+			ch <- prometheus.MustNewConstMetric(c.desc.appGroupSpawnerRecreations, prometheus.CounterValue, stats.spawnerRecreations, sg.Name, app, environment, group.ComponentName)
+			ch <- prometheus.MustNewConstMetric(c.desc.appGroupSpawnMethod, prometheus.GaugeValue, 1, sg.Name, app, environment, group.ComponentName, group.Options.SpawnMethod)
+			ch <- prometheus.MustNewConstMetric(c.desc.appGroupMaxPreloaderIdleTime, prometheus.GaugeValue, parseFloat(group.Options.MaxPreloaderIdleTime), sg.Name, app, environment, group.ComponentName)
+
+			// With sticky sessions, requests carrying a sticky session ID
+			// are routed to the processes with that ID even while others
+			// are idle, piling sessions up on few IDs.
+			if group.Options.StickySessions == "true" {
+				sessionsByID := make(map[string]float64)
+				for _, proc := range group.Processes {
+					if proc.StickySessionID == "" {
+						continue
+					}
+					sessions := parseFloat(proc.Sessions)
+					if math.IsNaN(sessions) {
+						sessions = 0
+					}
+					sessionsByID[proc.StickySessionID] += sessions
+				}
+				var total, maxSessions float64
+				for _, sessions := range sessionsByID {
+					total += sessions
+					maxSessions = max(maxSessions, sessions)
+				}
+				share := 0.0
+				if total > 0 {
+					share = maxSessions / total
+				}
+				ch <- prometheus.MustNewConstMetric(c.desc.appGroupStickyWorkers, prometheus.GaugeValue, float64(len(sessionsByID)), sg.Name, app, environment, group.ComponentName)
+				ch <- prometheus.MustNewConstMetric(c.desc.appGroupStickyMaxSessions, prometheus.GaugeValue, maxSessions, sg.Name, app, environment, group.ComponentName)
+				ch <- prometheus.MustNewConstMetric(c.desc.appGroupStickyMaxShare, prometheus.GaugeValue, share, sg.Name, app, environment, group.ComponentName)
+			}
+
+			// Update process identifiers map.
+			processIdentifiers := updateProcesses(processIdentifiers, group.Processes)
+			var other struct{ processes, memory, sessions float64 }
+			for _, proc := range group.Processes {
+				rate, sampled := snap.growth[proc.PID]
+				if sampled && rate > c.leakThreshold {
+					leaking++
+				}
+				isStuck := 0.0
+				if snap.stuck[proc.PID] {
+					isStuck = 1
+				}
+				stuckProcesses += isStuck
+				if snap.folded[processKey{group.Name, proc.PID}] {
+					other.processes++
+					other.memory += parseFloat(proc.RealMemory)
+					other.sessions += parseFloat(proc.Sessions)
+					continue
+				}
+				if bucketID, ok := processIdentifiers[proc.PID]; ok {
+					labels := c.procLabels(sg.Name, app, environment, group.ComponentName, strconv.Itoa(bucketID), snap.withPIDs, &proc)
+					ch <- prometheus.MustNewConstMetric(c.desc.procMemory, prometheus.GaugeValue, parseFloat(proc.RealMemory), labels...)
+					ch <- prometheus.MustNewConstMetric(c.desc.requestsProcessed, prometheus.CounterValue, parseFloat(proc.RequestsProcessed), labels...)
+					ch <- prometheus.MustNewConstMetric(c.desc.sessions, prometheus.GaugeValue, parseFloat(proc.Sessions), labels...)
+
+					if startTime, err := strconv.Atoi(proc.SpawnStartTime); err == nil {
+						ch <- prometheus.MustNewConstMetric(c.desc.procStartTime, prometheus.GaugeValue, float64(startTime/nanosecondsPerSecond), labels...)
+					}
+					if sampled {
+						ch <- prometheus.MustNewConstMetric(c.desc.procMemoryGrowth, prometheus.GaugeValue, rate, labels...)
+					}
+					if c.stuckThreshold > 0 {
+						ch <- prometheus.MustNewConstMetric(c.desc.procStuck, prometheus.GaugeValue, isStuck, labels...)
+					}
+				}
+			}
+			if c.limits.enabled() {
+				ch <- prometheus.MustNewConstMetric(c.desc.procFolded, prometheus.GaugeValue, other.processes, sg.Name, app, environment, group.ComponentName)
+			}
+			// Folded processes add up, leaving out their start times and
+			// requests processed. The processes folded change between
+			// scrapes, so their requests processed would not add up to a
+			// counter.
+			if other.processes > 0 {
+				labels := c.procLabels(sg.Name, app, environment, group.ComponentName, "other", false, nil)
+				ch <- prometheus.MustNewConstMetric(c.desc.procMemory, prometheus.GaugeValue, other.memory, labels...)
+				ch <- prometheus.MustNewConstMetric(c.desc.sessions, prometheus.GaugeValue, other.sessions, labels...)
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc.appProcsSpawning, prometheus.GaugeValue, spawning, sg.Name, app, environment)
+		if c.memoryWindow > 0 {
+			ch <- prometheus.MustNewConstMetric(c.desc.appLeakingWorkers, prometheus.GaugeValue, leaking, sg.Name, app, environment)
+		}
+		if c.stuckThreshold > 0 {
+			ch <- prometheus.MustNewConstMetric(c.desc.appStuckProcesses, prometheus.GaugeValue, stuckProcesses, sg.Name, app, environment)
 		}
 	}
+	c.queueDepth.Collect(ch)
+}
+
+// procLabels returns the label values of a process metric, adding the PID
+// labels of proc if the collector has them and withPIDs is set.
+func (c *Collector) procLabels(name, app, environment, component, id string, withPIDs bool, proc *Process) []string {
+	labels := []string{name, app, environment, component, id}
+	switch {
+	case c.pidLabels && withPIDs:
+		labels = append(labels, proc.PID, proc.GUPID)
+	case c.pidLabels:
+		labels = append(labels, "", "")
+	}
+	return labels
+}
+
+// collectQueue exports the size of a queue. Queues Passenger does not report
+// are left out.
+func (c *Collector) collectQueue(ch chan<- prometheus.Metric, level, name, app, environment, component, size string) {
+	requests := parseFloat(size)
+	if math.IsNaN(requests) {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc.queueRequests, prometheus.GaugeValue, requests, level, name, app, environment, component)
+}
+
+// observeQueue observes the size of a queue in the queue depth histogram.
+func (c *Collector) observeQueue(level, name, app, environment, component, size string) {
+	requests := parseFloat(size)
+	if math.IsNaN(requests) {
+		return
+	}
+	c.queueDepth.WithLabelValues(level, name, app, environment, component).Observe(requests)
+}
+
+// LastScrape returns when Passenger was last read from and the error it
+// failed with, if any. The time is zero before the first scrape.
+func (c *Collector) LastScrape() (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastScrape, c.lastScrapeErr
+}
+
+func (c *Collector) recordScrape(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastScrape = time.Now()
+	c.lastScrapeErr = err
+}
+
+// warnUnknownSchema logs a warning about the schema version of info, once
+// until it changes.
+func (c *Collector) warnUnknownSchema(info *Info) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.unknownSchema == info.SchemaVersion {
+		return
+	}
+	c.unknownSchema = info.SchemaVersion
+	c.logger.Warn("Unknown pool.xml schema version, parsing it like the latest known one",
+		"schema_version", info.SchemaVersion, "passenger_version", info.PassengerVersion)
 }
 
 // Copied from https://github.com/stuartnelson3/passenger_exporter/blob/80b16566cdab445f6e68f967019a95b67f608aca/main.go
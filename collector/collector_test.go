@@ -20,9 +20,16 @@ import (
 	"net/http"
 	"os"
 	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promslog"
 )
 
 type fakeReader struct {
@@ -73,221 +80,300 @@ func TestCollect(t *testing.T) {
 			wantMetrics: `# HELP passenger_app_count Number of apps.
 # TYPE passenger_app_count gauge
 passenger_app_count{hostname="local-machine"} 1
+# HELP passenger_app_group_max_preloader_idle_time_seconds Seconds a preloader may idle before it is shut down, 0 for never.
+# TYPE passenger_app_group_max_preloader_idle_time_seconds gauge
+passenger_app_group_max_preloader_idle_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",name="/srv/app/my_app (production)"} 300
 # HELP passenger_app_group_queue Number of requests in app group process queues.
 # TYPE passenger_app_group_queue gauge
-passenger_app_group_queue{default="true",group="/srv/app/my_app (production)",hostname="local-machine"} 0
-# HELP passenger_app_procs_spawning Number of processes spawning.
+passenger_app_group_queue{app="/srv/app/my_app",component="/srv/app/my_app (production)",default="true",environment="production",group="/srv/app/my_app (production)",hostname="local-machine"} 0
+# HELP passenger_app_group_spawn_method_info Spawn method configured for the app group.
+# TYPE passenger_app_group_spawn_method_info gauge
+passenger_app_group_spawn_method_info{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",method="direct",name="/srv/app/my_app (production)"} 1
+# HELP passenger_app_group_spawner_age_seconds Seconds since the newest spawner of the app group's processes was created.
+# TYPE passenger_app_group_spawner_age_seconds gauge
+passenger_app_group_spawner_age_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",name="/srv/app/my_app (production)"} 2.592e+06
+# HELP passenger_app_group_spawner_present Whether the app group has a preloader, estimated from its spawn method, last spawn and max preloader idle time.
+# TYPE passenger_app_group_spawner_present gauge
+passenger_app_group_spawner_present{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",name="/srv/app/my_app (production)"} 0
+# HELP passenger_app_group_spawner_recreations_total Number of spawner recreations observed for the app group.
+# TYPE passenger_app_group_spawner_recreations_total counter
+passenger_app_group_spawner_recreations_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",name="/srv/app/my_app (production)"} 0
+# HELP passenger_app_procs_spawning Number of processes spawning, summed over the groups of an app.
 # TYPE passenger_app_procs_spawning gauge
-passenger_app_procs_spawning{hostname="local-machine",name="/srv/app/my_app (production)"} 0
+passenger_app_procs_spawning{app="/srv/app/my_app",environment="production",hostname="local-machine",name="/srv/app/my_app (production)"} 0
 # HELP passenger_app_queue Number of requests in app process queues.
 # TYPE passenger_app_queue gauge
-passenger_app_queue{hostname="local-machine",name="/srv/app/my_app (production)"} 5
+passenger_app_queue{app="/srv/app/my_app",environment="production",hostname="local-machine",name="/srv/app/my_app (production)"} 5
 # HELP passenger_current_processes Current number of processes.
 # TYPE passenger_current_processes gauge
 passenger_current_processes{hostname="local-machine"} 48
 # HELP passenger_current_sessions Number of sessions currently being handled by a process.
 # TYPE passenger_current_sessions gauge
-passenger_current_sessions{hostname="local-machine",id="0",name="/srv/app/my_app (production)"} 1
-passenger_current_sessions{hostname="local-machine",id="1",name="/srv/app/my_app (production)"} 1
-passenger_current_sessions{hostname="local-machine",id="10",name="/srv/app/my_app (production)"} 1
-passenger_current_sessions{hostname="local-machine",id="11",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="12",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="13",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="14",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="15",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="16",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="17",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="18",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="19",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="2",name="/srv/app/my_app (production)"} 1
-passenger_current_sessions{hostname="local-machine",id="20",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="21",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="22",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="23",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="24",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="25",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="26",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="27",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="28",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="29",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="3",name="/srv/app/my_app (production)"} 1
-passenger_current_sessions{hostname="local-machine",id="30",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="31",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="32",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="33",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="34",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="35",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="36",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="37",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="38",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="39",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="4",name="/srv/app/my_app (production)"} 1
-passenger_current_sessions{hostname="local-machine",id="40",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="41",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="42",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="43",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="44",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="45",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="46",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="47",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="5",name="/srv/app/my_app (production)"} 1
-passenger_current_sessions{hostname="local-machine",id="6",name="/srv/app/my_app (production)"} 1
-passenger_current_sessions{hostname="local-machine",id="7",name="/srv/app/my_app (production)"} 0
-passenger_current_sessions{hostname="local-machine",id="8",name="/srv/app/my_app (production)"} 1
-passenger_current_sessions{hostname="local-machine",id="9",name="/srv/app/my_app (production)"} 1
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="0",name="/srv/app/my_app (production)"} 1
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="1",name="/srv/app/my_app (production)"} 1
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="10",name="/srv/app/my_app (production)"} 1
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="11",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="12",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="13",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="14",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="15",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="16",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="17",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="18",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="19",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="2",name="/srv/app/my_app (production)"} 1
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="20",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="21",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="22",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="23",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="24",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="25",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="26",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="27",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="28",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="29",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="3",name="/srv/app/my_app (production)"} 1
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="30",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="31",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="32",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="33",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="34",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="35",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="36",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="37",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="38",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="39",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="4",name="/srv/app/my_app (production)"} 1
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="40",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="41",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="42",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="43",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="44",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="45",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="46",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="47",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="5",name="/srv/app/my_app (production)"} 1
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="6",name="/srv/app/my_app (production)"} 1
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="7",name="/srv/app/my_app (production)"} 0
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="8",name="/srv/app/my_app (production)"} 1
+passenger_current_sessions{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="9",name="/srv/app/my_app (production)"} 1
 # HELP passenger_max_processes Configured maximum number of processes.
 # TYPE passenger_max_processes gauge
 passenger_max_processes{hostname="local-machine"} 48
 # HELP passenger_proc_memory Memory consumed by a process
 # TYPE passenger_proc_memory gauge
-passenger_proc_memory{hostname="local-machine",id="0",name="/srv/app/my_app (production)"} 330012
-passenger_proc_memory{hostname="local-machine",id="1",name="/srv/app/my_app (production)"} 303296
-passenger_proc_memory{hostname="local-machine",id="10",name="/srv/app/my_app (production)"} 303984
-passenger_proc_memory{hostname="local-machine",id="11",name="/srv/app/my_app (production)"} 289680
-passenger_proc_memory{hostname="local-machine",id="12",name="/srv/app/my_app (production)"} 306148
-passenger_proc_memory{hostname="local-machine",id="13",name="/srv/app/my_app (production)"} 293128
-passenger_proc_memory{hostname="local-machine",id="14",name="/srv/app/my_app (production)"} 322064
-passenger_proc_memory{hostname="local-machine",id="15",name="/srv/app/my_app (production)"} 297124
-passenger_proc_memory{hostname="local-machine",id="16",name="/srv/app/my_app (production)"} 290364
-passenger_proc_memory{hostname="local-machine",id="17",name="/srv/app/my_app (production)"} 292056
-passenger_proc_memory{hostname="local-machine",id="18",name="/srv/app/my_app (production)"} 272784
-passenger_proc_memory{hostname="local-machine",id="19",name="/srv/app/my_app (production)"} 281176
-passenger_proc_memory{hostname="local-machine",id="2",name="/srv/app/my_app (production)"} 288884
-passenger_proc_memory{hostname="local-machine",id="20",name="/srv/app/my_app (production)"} 269520
-passenger_proc_memory{hostname="local-machine",id="21",name="/srv/app/my_app (production)"} 269404
-passenger_proc_memory{hostname="local-machine",id="22",name="/srv/app/my_app (production)"} 275844
-passenger_proc_memory{hostname="local-machine",id="23",name="/srv/app/my_app (production)"} 276412
-passenger_proc_memory{hostname="local-machine",id="24",name="/srv/app/my_app (production)"} 267316
-passenger_proc_memory{hostname="local-machine",id="25",name="/srv/app/my_app (production)"} 265152
-passenger_proc_memory{hostname="local-machine",id="26",name="/srv/app/my_app (production)"} 261144
-passenger_proc_memory{hostname="local-machine",id="27",name="/srv/app/my_app (production)"} 260224
-passenger_proc_memory{hostname="local-machine",id="28",name="/srv/app/my_app (production)"} 243688
-passenger_proc_memory{hostname="local-machine",id="29",name="/srv/app/my_app (production)"} 243724
-passenger_proc_memory{hostname="local-machine",id="3",name="/srv/app/my_app (production)"} 293316
-passenger_proc_memory{hostname="local-machine",id="30",name="/srv/app/my_app (production)"} 261492
-passenger_proc_memory{hostname="local-machine",id="31",name="/srv/app/my_app (production)"} 260196
-passenger_proc_memory{hostname="local-machine",id="32",name="/srv/app/my_app (production)"} 244720
-passenger_proc_memory{hostname="local-machine",id="33",name="/srv/app/my_app (production)"} 261268
-passenger_proc_memory{hostname="local-machine",id="34",name="/srv/app/my_app (production)"} 261320
-passenger_proc_memory{hostname="local-machine",id="35",name="/srv/app/my_app (production)"} 244740
-passenger_proc_memory{hostname="local-machine",id="36",name="/srv/app/my_app (production)"} 244656
-passenger_proc_memory{hostname="local-machine",id="37",name="/srv/app/my_app (production)"} 244860
-passenger_proc_memory{hostname="local-machine",id="38",name="/srv/app/my_app (production)"} 244752
-passenger_proc_memory{hostname="local-machine",id="39",name="/srv/app/my_app (production)"} 244708
-passenger_proc_memory{hostname="local-machine",id="4",name="/srv/app/my_app (production)"} 330412
-passenger_proc_memory{hostname="local-machine",id="40",name="/srv/app/my_app (production)"} 244684
-passenger_proc_memory{hostname="local-machine",id="41",name="/srv/app/my_app (production)"} 255428
-passenger_proc_memory{hostname="local-machine",id="42",name="/srv/app/my_app (production)"} 243744
-passenger_proc_memory{hostname="local-machine",id="43",name="/srv/app/my_app (production)"} 254432
-passenger_proc_memory{hostname="local-machine",id="44",name="/srv/app/my_app (production)"} 243592
-passenger_proc_memory{hostname="local-machine",id="45",name="/srv/app/my_app (production)"} 244640
-passenger_proc_memory{hostname="local-machine",id="46",name="/srv/app/my_app (production)"} 242576
-passenger_proc_memory{hostname="local-machine",id="47",name="/srv/app/my_app (production)"} 255376
-passenger_proc_memory{hostname="local-machine",id="5",name="/srv/app/my_app (production)"} 306904
-passenger_proc_memory{hostname="local-machine",id="6",name="/srv/app/my_app (production)"} 330644
-passenger_proc_memory{hostname="local-machine",id="7",name="/srv/app/my_app (production)"} 315104
-passenger_proc_memory{hostname="local-machine",id="8",name="/srv/app/my_app (production)"} 288508
-passenger_proc_memory{hostname="local-machine",id="9",name="/srv/app/my_app (production)"} 306520
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="0",name="/srv/app/my_app (production)"} 330012
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="1",name="/srv/app/my_app (production)"} 303296
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="10",name="/srv/app/my_app (production)"} 303984
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="11",name="/srv/app/my_app (production)"} 289680
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="12",name="/srv/app/my_app (production)"} 306148
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="13",name="/srv/app/my_app (production)"} 293128
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="14",name="/srv/app/my_app (production)"} 322064
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="15",name="/srv/app/my_app (production)"} 297124
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="16",name="/srv/app/my_app (production)"} 290364
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="17",name="/srv/app/my_app (production)"} 292056
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="18",name="/srv/app/my_app (production)"} 272784
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="19",name="/srv/app/my_app (production)"} 281176
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="2",name="/srv/app/my_app (production)"} 288884
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="20",name="/srv/app/my_app (production)"} 269520
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="21",name="/srv/app/my_app (production)"} 269404
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="22",name="/srv/app/my_app (production)"} 275844
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="23",name="/srv/app/my_app (production)"} 276412
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="24",name="/srv/app/my_app (production)"} 267316
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="25",name="/srv/app/my_app (production)"} 265152
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="26",name="/srv/app/my_app (production)"} 261144
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="27",name="/srv/app/my_app (production)"} 260224
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="28",name="/srv/app/my_app (production)"} 243688
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="29",name="/srv/app/my_app (production)"} 243724
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="3",name="/srv/app/my_app (production)"} 293316
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="30",name="/srv/app/my_app (production)"} 261492
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="31",name="/srv/app/my_app (production)"} 260196
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="32",name="/srv/app/my_app (production)"} 244720
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="33",name="/srv/app/my_app (production)"} 261268
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="34",name="/srv/app/my_app (production)"} 261320
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="35",name="/srv/app/my_app (production)"} 244740
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="36",name="/srv/app/my_app (production)"} 244656
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="37",name="/srv/app/my_app (production)"} 244860
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="38",name="/srv/app/my_app (production)"} 244752
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="39",name="/srv/app/my_app (production)"} 244708
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="4",name="/srv/app/my_app (production)"} 330412
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="40",name="/srv/app/my_app (production)"} 244684
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="41",name="/srv/app/my_app (production)"} 255428
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="42",name="/srv/app/my_app (production)"} 243744
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="43",name="/srv/app/my_app (production)"} 254432
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="44",name="/srv/app/my_app (production)"} 243592
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="45",name="/srv/app/my_app (production)"} 244640
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="46",name="/srv/app/my_app (production)"} 242576
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="47",name="/srv/app/my_app (production)"} 255376
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="5",name="/srv/app/my_app (production)"} 306904
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="6",name="/srv/app/my_app (production)"} 330644
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="7",name="/srv/app/my_app (production)"} 315104
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="8",name="/srv/app/my_app (production)"} 288508
+passenger_proc_memory{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="9",name="/srv/app/my_app (production)"} 306520
 # HELP passenger_proc_start_time_seconds Number of seconds since processor started.
 # TYPE passenger_proc_start_time_seconds gauge
-passenger_proc_start_time_seconds{hostname="local-machine",id="0",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="1",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="10",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="11",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="12",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="13",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="14",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="15",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="16",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="17",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="18",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="19",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="2",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="20",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="21",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="22",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="23",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="24",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="25",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="26",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="27",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="28",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="29",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="3",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="30",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="31",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="32",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="33",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="34",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="35",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="36",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="37",name="/srv/app/my_app (production)"} 1.462478e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="38",name="/srv/app/my_app (production)"} 1.462478e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="39",name="/srv/app/my_app (production)"} 1.462478e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="4",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="40",name="/srv/app/my_app (production)"} 1.462478e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="41",name="/srv/app/my_app (production)"} 1.462478e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="42",name="/srv/app/my_app (production)"} 1.462478e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="43",name="/srv/app/my_app (production)"} 1.462478e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="44",name="/srv/app/my_app (production)"} 1.462478e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="45",name="/srv/app/my_app (production)"} 1.462478e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="46",name="/srv/app/my_app (production)"} 1.462478e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="47",name="/srv/app/my_app (production)"} 1.462478e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="5",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="6",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="7",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="8",name="/srv/app/my_app (production)"} 1.462477e+06
-passenger_proc_start_time_seconds{hostname="local-machine",id="9",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="0",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="1",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="10",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="11",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="12",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="13",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="14",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="15",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="16",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="17",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="18",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="19",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="2",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="20",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="21",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="22",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="23",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="24",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="25",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="26",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="27",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="28",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="29",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="3",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="30",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="31",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="32",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="33",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="34",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="35",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="36",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="37",name="/srv/app/my_app (production)"} 1.462478e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="38",name="/srv/app/my_app (production)"} 1.462478e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="39",name="/srv/app/my_app (production)"} 1.462478e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="4",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="40",name="/srv/app/my_app (production)"} 1.462478e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="41",name="/srv/app/my_app (production)"} 1.462478e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="42",name="/srv/app/my_app (production)"} 1.462478e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="43",name="/srv/app/my_app (production)"} 1.462478e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="44",name="/srv/app/my_app (production)"} 1.462478e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="45",name="/srv/app/my_app (production)"} 1.462478e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="46",name="/srv/app/my_app (production)"} 1.462478e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="47",name="/srv/app/my_app (production)"} 1.462478e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="5",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="6",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="7",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="8",name="/srv/app/my_app (production)"} 1.462477e+06
+passenger_proc_start_time_seconds{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="9",name="/srv/app/my_app (production)"} 1.462477e+06
+# HELP passenger_queue_depth_requests Number of requests waiting in a queue as observed on every read, by queue level.
+# TYPE passenger_queue_depth_requests histogram
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="0",level="disable",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="1",level="disable",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="2",level="disable",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="5",level="disable",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="10",level="disable",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="20",level="disable",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="50",level="disable",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="100",level="disable",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="200",level="disable",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="500",level="disable",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="1000",level="disable",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="+Inf",level="disable",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_sum{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",level="disable",name="/srv/app/my_app (production)"} 0
+passenger_queue_depth_requests_count{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",level="disable",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="0",level="group",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="1",level="group",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="2",level="group",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="5",level="group",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="10",level="group",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="20",level="group",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="50",level="group",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="100",level="group",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="200",level="group",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="500",level="group",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="1000",level="group",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",le="+Inf",level="group",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_sum{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",level="group",name="/srv/app/my_app (production)"} 0
+passenger_queue_depth_requests_count{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",level="group",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="",environment="production",hostname="local-machine",le="0",level="supergroup",name="/srv/app/my_app (production)"} 0
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="",environment="production",hostname="local-machine",le="1",level="supergroup",name="/srv/app/my_app (production)"} 0
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="",environment="production",hostname="local-machine",le="2",level="supergroup",name="/srv/app/my_app (production)"} 0
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="",environment="production",hostname="local-machine",le="5",level="supergroup",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="",environment="production",hostname="local-machine",le="10",level="supergroup",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="",environment="production",hostname="local-machine",le="20",level="supergroup",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="",environment="production",hostname="local-machine",le="50",level="supergroup",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="",environment="production",hostname="local-machine",le="100",level="supergroup",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="",environment="production",hostname="local-machine",le="200",level="supergroup",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="",environment="production",hostname="local-machine",le="500",level="supergroup",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="",environment="production",hostname="local-machine",le="1000",level="supergroup",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="/srv/app/my_app",component="",environment="production",hostname="local-machine",le="+Inf",level="supergroup",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_sum{app="/srv/app/my_app",component="",environment="production",hostname="local-machine",level="supergroup",name="/srv/app/my_app (production)"} 5
+passenger_queue_depth_requests_count{app="/srv/app/my_app",component="",environment="production",hostname="local-machine",level="supergroup",name="/srv/app/my_app (production)"} 1
+passenger_queue_depth_requests_bucket{app="",component="",environment="",hostname="local-machine",le="0",level="toplevel",name=""} 0
+passenger_queue_depth_requests_bucket{app="",component="",environment="",hostname="local-machine",le="1",level="toplevel",name=""} 0
+passenger_queue_depth_requests_bucket{app="",component="",environment="",hostname="local-machine",le="2",level="toplevel",name=""} 0
+passenger_queue_depth_requests_bucket{app="",component="",environment="",hostname="local-machine",le="5",level="toplevel",name=""} 1
+passenger_queue_depth_requests_bucket{app="",component="",environment="",hostname="local-machine",le="10",level="toplevel",name=""} 1
+passenger_queue_depth_requests_bucket{app="",component="",environment="",hostname="local-machine",le="20",level="toplevel",name=""} 1
+passenger_queue_depth_requests_bucket{app="",component="",environment="",hostname="local-machine",le="50",level="toplevel",name=""} 1
+passenger_queue_depth_requests_bucket{app="",component="",environment="",hostname="local-machine",le="100",level="toplevel",name=""} 1
+passenger_queue_depth_requests_bucket{app="",component="",environment="",hostname="local-machine",le="200",level="toplevel",name=""} 1
+passenger_queue_depth_requests_bucket{app="",component="",environment="",hostname="local-machine",le="500",level="toplevel",name=""} 1
+passenger_queue_depth_requests_bucket{app="",component="",environment="",hostname="local-machine",le="1000",level="toplevel",name=""} 1
+passenger_queue_depth_requests_bucket{app="",component="",environment="",hostname="local-machine",le="+Inf",level="toplevel",name=""} 1
+passenger_queue_depth_requests_sum{app="",component="",environment="",hostname="local-machine",level="toplevel",name=""} 3
+passenger_queue_depth_requests_count{app="",component="",environment="",hostname="local-machine",level="toplevel",name=""} 1
+# HELP passenger_queue_requests Number of requests waiting in a queue, by queue level: toplevel, supergroup (app), group or disable.
+# TYPE passenger_queue_requests gauge
+passenger_queue_requests{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",level="disable",name="/srv/app/my_app (production)"} 0
+passenger_queue_requests{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",level="group",name="/srv/app/my_app (production)"} 0
+passenger_queue_requests{app="/srv/app/my_app",component="",environment="production",hostname="local-machine",level="supergroup",name="/srv/app/my_app (production)"} 5
+passenger_queue_requests{app="",component="",environment="",hostname="local-machine",level="toplevel",name=""} 3
 # HELP passenger_requests_processed_total Number of processes served by a process.
 # TYPE passenger_requests_processed_total counter
-passenger_requests_processed_total{hostname="local-machine",id="0",name="/srv/app/my_app (production)"} 43578
-passenger_requests_processed_total{hostname="local-machine",id="1",name="/srv/app/my_app (production)"} 48130
-passenger_requests_processed_total{hostname="local-machine",id="10",name="/srv/app/my_app (production)"} 26226
-passenger_requests_processed_total{hostname="local-machine",id="11",name="/srv/app/my_app (production)"} 22752
-passenger_requests_processed_total{hostname="local-machine",id="12",name="/srv/app/my_app (production)"} 18646
-passenger_requests_processed_total{hostname="local-machine",id="13",name="/srv/app/my_app (production)"} 15254
-passenger_requests_processed_total{hostname="local-machine",id="14",name="/srv/app/my_app (production)"} 11561
-passenger_requests_processed_total{hostname="local-machine",id="15",name="/srv/app/my_app (production)"} 9107
-passenger_requests_processed_total{hostname="local-machine",id="16",name="/srv/app/my_app (production)"} 6831
-passenger_requests_processed_total{hostname="local-machine",id="17",name="/srv/app/my_app (production)"} 4804
-passenger_requests_processed_total{hostname="local-machine",id="18",name="/srv/app/my_app (production)"} 3420
-passenger_requests_processed_total{hostname="local-machine",id="19",name="/srv/app/my_app (production)"} 2150
-passenger_requests_processed_total{hostname="local-machine",id="2",name="/srv/app/my_app (production)"} 46701
-passenger_requests_processed_total{hostname="local-machine",id="20",name="/srv/app/my_app (production)"} 1333
-passenger_requests_processed_total{hostname="local-machine",id="21",name="/srv/app/my_app (production)"} 809
-passenger_requests_processed_total{hostname="local-machine",id="22",name="/srv/app/my_app (production)"} 504
-passenger_requests_processed_total{hostname="local-machine",id="23",name="/srv/app/my_app (production)"} 288
-passenger_requests_processed_total{hostname="local-machine",id="24",name="/srv/app/my_app (production)"} 161
-passenger_requests_processed_total{hostname="local-machine",id="25",name="/srv/app/my_app (production)"} 99
-passenger_requests_processed_total{hostname="local-machine",id="26",name="/srv/app/my_app (production)"} 60
-passenger_requests_processed_total{hostname="local-machine",id="27",name="/srv/app/my_app (production)"} 49
-passenger_requests_processed_total{hostname="local-machine",id="28",name="/srv/app/my_app (production)"} 24
-passenger_requests_processed_total{hostname="local-machine",id="29",name="/srv/app/my_app (production)"} 19
-passenger_requests_processed_total{hostname="local-machine",id="3",name="/srv/app/my_app (production)"} 45134
-passenger_requests_processed_total{hostname="local-machine",id="30",name="/srv/app/my_app (production)"} 9
-passenger_requests_processed_total{hostname="local-machine",id="31",name="/srv/app/my_app (production)"} 5
-passenger_requests_processed_total{hostname="local-machine",id="32",name="/srv/app/my_app (production)"} 4
-passenger_requests_processed_total{hostname="local-machine",id="33",name="/srv/app/my_app (production)"} 4
-passenger_requests_processed_total{hostname="local-machine",id="34",name="/srv/app/my_app (production)"} 2
-passenger_requests_processed_total{hostname="local-machine",id="35",name="/srv/app/my_app (production)"} 2
-passenger_requests_processed_total{hostname="local-machine",id="36",name="/srv/app/my_app (production)"} 0
-passenger_requests_processed_total{hostname="local-machine",id="37",name="/srv/app/my_app (production)"} 0
-passenger_requests_processed_total{hostname="local-machine",id="38",name="/srv/app/my_app (production)"} 0
-passenger_requests_processed_total{hostname="local-machine",id="39",name="/srv/app/my_app (production)"} 0
-passenger_requests_processed_total{hostname="local-machine",id="4",name="/srv/app/my_app (production)"} 42932
-passenger_requests_processed_total{hostname="local-machine",id="40",name="/srv/app/my_app (production)"} 0
-passenger_requests_processed_total{hostname="local-machine",id="41",name="/srv/app/my_app (production)"} 0
-passenger_requests_processed_total{hostname="local-machine",id="42",name="/srv/app/my_app (production)"} 0
-passenger_requests_processed_total{hostname="local-machine",id="43",name="/srv/app/my_app (production)"} 0
-passenger_requests_processed_total{hostname="local-machine",id="44",name="/srv/app/my_app (production)"} 0
-passenger_requests_processed_total{hostname="local-machine",id="45",name="/srv/app/my_app (production)"} 0
-passenger_requests_processed_total{hostname="local-machine",id="46",name="/srv/app/my_app (production)"} 0
-passenger_requests_processed_total{hostname="local-machine",id="47",name="/srv/app/my_app (production)"} 0
-passenger_requests_processed_total{hostname="local-machine",id="5",name="/srv/app/my_app (production)"} 40815
-passenger_requests_processed_total{hostname="local-machine",id="6",name="/srv/app/my_app (production)"} 38615
-passenger_requests_processed_total{hostname="local-machine",id="7",name="/srv/app/my_app (production)"} 35802
-passenger_requests_processed_total{hostname="local-machine",id="8",name="/srv/app/my_app (production)"} 33600
-passenger_requests_processed_total{hostname="local-machine",id="9",name="/srv/app/my_app (production)"} 30490
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="0",name="/srv/app/my_app (production)"} 43578
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="1",name="/srv/app/my_app (production)"} 48130
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="10",name="/srv/app/my_app (production)"} 26226
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="11",name="/srv/app/my_app (production)"} 22752
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="12",name="/srv/app/my_app (production)"} 18646
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="13",name="/srv/app/my_app (production)"} 15254
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="14",name="/srv/app/my_app (production)"} 11561
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="15",name="/srv/app/my_app (production)"} 9107
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="16",name="/srv/app/my_app (production)"} 6831
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="17",name="/srv/app/my_app (production)"} 4804
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="18",name="/srv/app/my_app (production)"} 3420
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="19",name="/srv/app/my_app (production)"} 2150
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="2",name="/srv/app/my_app (production)"} 46701
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="20",name="/srv/app/my_app (production)"} 1333
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="21",name="/srv/app/my_app (production)"} 809
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="22",name="/srv/app/my_app (production)"} 504
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="23",name="/srv/app/my_app (production)"} 288
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="24",name="/srv/app/my_app (production)"} 161
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="25",name="/srv/app/my_app (production)"} 99
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="26",name="/srv/app/my_app (production)"} 60
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="27",name="/srv/app/my_app (production)"} 49
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="28",name="/srv/app/my_app (production)"} 24
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="29",name="/srv/app/my_app (production)"} 19
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="3",name="/srv/app/my_app (production)"} 45134
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="30",name="/srv/app/my_app (production)"} 9
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="31",name="/srv/app/my_app (production)"} 5
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="32",name="/srv/app/my_app (production)"} 4
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="33",name="/srv/app/my_app (production)"} 4
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="34",name="/srv/app/my_app (production)"} 2
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="35",name="/srv/app/my_app (production)"} 2
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="36",name="/srv/app/my_app (production)"} 0
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="37",name="/srv/app/my_app (production)"} 0
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="38",name="/srv/app/my_app (production)"} 0
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="39",name="/srv/app/my_app (production)"} 0
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="4",name="/srv/app/my_app (production)"} 42932
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="40",name="/srv/app/my_app (production)"} 0
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="41",name="/srv/app/my_app (production)"} 0
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="42",name="/srv/app/my_app (production)"} 0
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="43",name="/srv/app/my_app (production)"} 0
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="44",name="/srv/app/my_app (production)"} 0
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="45",name="/srv/app/my_app (production)"} 0
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="46",name="/srv/app/my_app (production)"} 0
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="47",name="/srv/app/my_app (production)"} 0
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="5",name="/srv/app/my_app (production)"} 40815
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="6",name="/srv/app/my_app (production)"} 38615
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="7",name="/srv/app/my_app (production)"} 35802
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="8",name="/srv/app/my_app (production)"} 33600
+passenger_requests_processed_total{app="/srv/app/my_app",component="/srv/app/my_app (production)",environment="production",hostname="local-machine",id="9",name="/srv/app/my_app (production)"} 30490
 # HELP passenger_top_level_queue Number of requests in the top-level queue.
 # TYPE passenger_top_level_queue gauge
 passenger_top_level_queue{hostname="local-machine"} 3
@@ -320,6 +406,8 @@ passenger_version{hostname="local-machine",version="5.0.26"} 1
 		t.Run(tc.name, func(t *testing.T) {
 			reader := &fakeReader{ReaderFunc: tc.readerFunc}
 			collector := New(reader)
+			// A month after the spawner of the fixture was created.
+			collector.now = func() time.Time { return time.UnixMicro(1460126877627875).Add(30 * 24 * time.Hour) }
 
 			buf := bytes.NewReader([]byte(tc.wantMetrics))
 			err := testutil.CollectAndCompare(collector, buf)
@@ -333,6 +421,471 @@ passenger_version{hostname="local-machine",version="5.0.26"} 1
 	}
 }
 
+func TestCollect_Groups(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/synthetic_passenger4_xml_output.xml")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	t.Setenv("HOSTNAME", "local-machine")
+
+	reader := &fakeReader{ReaderFunc: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(fixture)), nil }}
+	want := `# HELP passenger_app_group_queue Number of requests in app group process queues.
+# TYPE passenger_app_group_queue gauge
+passenger_app_group_queue{app="/srv/app/legacy_app",component="default",default="true",environment="production",group="/srv/app/legacy_app#default",hostname="local-machine"} 2
+passenger_app_group_queue{app="/srv/app/legacy_app",component="worker",default="",environment="production",group="/srv/app/legacy_app#worker",hostname="local-machine"} 1
+# HELP passenger_app_procs_spawning Number of processes spawning, summed over the groups of an app.
+# TYPE passenger_app_procs_spawning gauge
+passenger_app_procs_spawning{app="/srv/app/legacy_app",environment="production",hostname="local-machine",name="/srv/app/legacy_app"} 1
+# HELP passenger_proc_memory Memory consumed by a process
+# TYPE passenger_proc_memory gauge
+passenger_proc_memory{app="/srv/app/legacy_app",component="default",environment="production",hostname="local-machine",id="0",name="/srv/app/legacy_app"} 210000
+passenger_proc_memory{app="/srv/app/legacy_app",component="default",environment="production",hostname="local-machine",id="1",name="/srv/app/legacy_app"} 225000
+passenger_proc_memory{app="/srv/app/legacy_app",component="worker",environment="production",hostname="local-machine",id="0",name="/srv/app/legacy_app"} 180000
+`
+	err = testutil.CollectAndCompare(New(reader), strings.NewReader(want),
+		"passenger_app_group_queue", "passenger_app_procs_spawning", "passenger_proc_memory")
+	if err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
+
+func TestCollect_Enterprise(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/synthetic_passenger6_enterprise_xml_output.xml")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	t.Setenv("HOSTNAME", "local-machine")
+
+	reader := &fakeReader{ReaderFunc: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(fixture)), nil }}
+	want := `# HELP passenger_app_group_detached_processes Number of processes detached by a rolling restart that are still shutting down.
+# TYPE passenger_app_group_detached_processes gauge
+passenger_app_group_detached_processes{app="/srv/app/api",component="/srv/app/api (production)",environment="production",hostname="local-machine",name="/srv/app/api (production)"} 0
+passenger_app_group_detached_processes{app="/srv/app/web",component="/srv/app/web (production)",environment="production",hostname="local-machine",name="/srv/app/web (production)"} 1
+# HELP passenger_app_group_restart_progress_ratio Share of the processes of the app group replaced by the rolling restart in progress, 1 if there is none.
+# TYPE passenger_app_group_restart_progress_ratio gauge
+passenger_app_group_restart_progress_ratio{app="/srv/app/api",component="/srv/app/api (production)",environment="production",hostname="local-machine",name="/srv/app/api (production)"} 1
+passenger_app_group_restart_progress_ratio{app="/srv/app/web",component="/srv/app/web (production)",environment="production",hostname="local-machine",name="/srv/app/web (production)"} 0
+# HELP passenger_app_group_restarting Whether a rolling restart of the app group is in progress.
+# TYPE passenger_app_group_restarting gauge
+passenger_app_group_restarting{app="/srv/app/api",component="/srv/app/api (production)",environment="production",hostname="local-machine",name="/srv/app/api (production)"} 0
+passenger_app_group_restarting{app="/srv/app/web",component="/srv/app/web (production)",environment="production",hostname="local-machine",name="/srv/app/web (production)"} 1
+# HELP passenger_app_group_restarts_initiated_total Number of rolling restarts of the app group initiated.
+# TYPE passenger_app_group_restarts_initiated_total counter
+passenger_app_group_restarts_initiated_total{app="/srv/app/api",component="/srv/app/api (production)",environment="production",hostname="local-machine",name="/srv/app/api (production)"} 1
+passenger_app_group_restarts_initiated_total{app="/srv/app/web",component="/srv/app/web (production)",environment="production",hostname="local-machine",name="/srv/app/web (production)"} 3
+`
+	err = testutil.CollectAndCompare(New(reader), strings.NewReader(want),
+		"passenger_app_group_detached_processes", "passenger_app_group_restart_progress_ratio",
+		"passenger_app_group_restarting", "passenger_app_group_restarts_initiated_total")
+	if err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+
+	// Open source pools report no rolling restarts.
+	fixture, err = os.ReadFile("testdata/synthetic_passenger6_xml_output.xml")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	if got := testutil.CollectAndCount(New(reader), "passenger_app_group_restarting"); got != 0 {
+		t.Errorf("expected no passenger_app_group_restarting series, got %d", got)
+	}
+}
+
+func TestCollect_StickySessions(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/synthetic_passenger6_xml_output.xml")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	t.Setenv("HOSTNAME", "local-machine")
+
+	// Only the web app uses sticky sessions, with two processes of distinct
+	// sticky session IDs, one of them handling a session.
+	reader := &fakeReader{ReaderFunc: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(fixture)), nil }}
+	want := `# HELP passenger_app_group_sticky_max_session_share Share of the sessions of an app group using sticky sessions handled under its busiest sticky session ID.
+# TYPE passenger_app_group_sticky_max_session_share gauge
+passenger_app_group_sticky_max_session_share{app="/srv/app/web",component="/srv/app/web (production)",environment="production",hostname="local-machine",name="/srv/app/web (production)"} 1
+# HELP passenger_app_group_sticky_max_sessions Most sessions handled under one sticky session ID of an app group using sticky sessions.
+# TYPE passenger_app_group_sticky_max_sessions gauge
+passenger_app_group_sticky_max_sessions{app="/srv/app/web",component="/srv/app/web (production)",environment="production",hostname="local-machine",name="/srv/app/web (production)"} 1
+# HELP passenger_app_group_sticky_workers Number of distinct sticky session IDs of the processes of an app group using sticky sessions.
+# TYPE passenger_app_group_sticky_workers gauge
+passenger_app_group_sticky_workers{app="/srv/app/web",component="/srv/app/web (production)",environment="production",hostname="local-machine",name="/srv/app/web (production)"} 2
+`
+	err = testutil.CollectAndCompare(New(reader), strings.NewReader(want),
+		"passenger_app_group_sticky_max_session_share", "passenger_app_group_sticky_max_sessions", "passenger_app_group_sticky_workers")
+	if err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+
+	// Four processes are busy, but two of them share a sticky session ID
+	// and one has none, so sessions pile up on two IDs.
+	var b strings.Builder
+	b.WriteString(`<info version="3"><supergroups><supergroup><name>web</name><group default="true"><name>web</name><component_name>web</component_name>`)
+	b.WriteString(`<options><sticky_sessions>true</sticky_sessions></options><processes>`)
+	for i, proc := range []struct {
+		stickySessionID string
+		sessions        int
+	}{{"1", 6}, {"2", 1}, {"2", 1}, {"", 2}} {
+		fmt.Fprintf(&b, `<process><pid>%d</pid><sticky_session_id>%s</sticky_session_id><sessions>%d</sessions></process>`, 100+i, proc.stickySessionID, proc.sessions)
+	}
+	b.WriteString(`</processes></group></supergroup></supergroups></info>`)
+	skewed := []byte(b.String())
+	reader = &fakeReader{ReaderFunc: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(skewed)), nil }}
+	want = `# HELP passenger_app_group_sticky_max_session_share Share of the sessions of an app group using sticky sessions handled under its busiest sticky session ID.
+# TYPE passenger_app_group_sticky_max_session_share gauge
+passenger_app_group_sticky_max_session_share{app="web",component="web",environment="",hostname="local-machine",name="web"} 0.75
+# HELP passenger_app_group_sticky_max_sessions Most sessions handled under one sticky session ID of an app group using sticky sessions.
+# TYPE passenger_app_group_sticky_max_sessions gauge
+passenger_app_group_sticky_max_sessions{app="web",component="web",environment="",hostname="local-machine",name="web"} 6
+# HELP passenger_app_group_sticky_workers Number of distinct sticky session IDs of the processes of an app group using sticky sessions.
+# TYPE passenger_app_group_sticky_workers gauge
+passenger_app_group_sticky_workers{app="web",component="web",environment="",hostname="local-machine",name="web"} 2
+`
+	err = testutil.CollectAndCompare(New(reader), strings.NewReader(want),
+		"passenger_app_group_sticky_max_session_share", "passenger_app_group_sticky_max_sessions", "passenger_app_group_sticky_workers")
+	if err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
+
+func TestCollect_PIDLabels(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/synthetic_passenger6_xml_output.xml")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	t.Setenv("HOSTNAME", "local-machine")
+	reader := &fakeReader{ReaderFunc: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(fixture)), nil }}
+
+	want := `# HELP passenger_proc_memory Memory consumed by a process
+# TYPE passenger_proc_memory gauge
+passenger_proc_memory{app="/srv/app/api",component="/srv/app/api (production)",environment="production",gupid="2c3d4e6-UvWxYzAbCd",hostname="local-machine",id="0",name="/srv/app/api (production)",pid="3201"} 190000
+passenger_proc_memory{app="/srv/app/web",component="/srv/app/web (production)",environment="production",gupid="2c3d4e5-AbCdEfGhIj",hostname="local-machine",id="0",name="/srv/app/web (production)",pid="3101"} 260000
+passenger_proc_memory{app="/srv/app/web",component="/srv/app/web (production)",environment="production",gupid="2c3d4e5-KlMnOpQrSt",hostname="local-machine",id="1",name="/srv/app/web (production)",pid="3102"} 255000
+# HELP passenger_proc_pid_labels_dropped Number of processes exported with slot IDs instead of PID labels because there are more processes than allowed.
+# TYPE passenger_proc_pid_labels_dropped gauge
+passenger_proc_pid_labels_dropped{hostname="local-machine"} 0
+`
+	err = testutil.CollectAndCompare(New(reader, WithPIDLabels(3)), strings.NewReader(want),
+		"passenger_proc_memory", "passenger_proc_pid_labels_dropped")
+	if err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+
+	// Past the cap, processes fall back to their slot ID.
+	c := New(reader, WithPIDLabels(2))
+	testutil.CollectAndCount(c)
+	want = `# HELP passenger_proc_memory Memory consumed by a process
+# TYPE passenger_proc_memory gauge
+passenger_proc_memory{app="/srv/app/api",component="/srv/app/api (production)",environment="production",gupid="",hostname="local-machine",id="0",name="/srv/app/api (production)",pid=""} 190000
+passenger_proc_memory{app="/srv/app/web",component="/srv/app/web (production)",environment="production",gupid="",hostname="local-machine",id="0",name="/srv/app/web (production)",pid=""} 260000
+passenger_proc_memory{app="/srv/app/web",component="/srv/app/web (production)",environment="production",gupid="",hostname="local-machine",id="1",name="/srv/app/web (production)",pid=""} 255000
+# HELP passenger_proc_pid_labels_dropped Number of processes exported with slot IDs instead of PID labels because there are more processes than allowed.
+# TYPE passenger_proc_pid_labels_dropped gauge
+passenger_proc_pid_labels_dropped{hostname="local-machine"} 3
+`
+	err = testutil.CollectAndCompare(c, strings.NewReader(want),
+		"passenger_proc_memory", "passenger_proc_pid_labels_dropped")
+	if err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
+
+func TestCollect_ProcessLimits(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/synthetic_passenger6_xml_output.xml")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	t.Setenv("HOSTNAME", "local-machine")
+	reader := &fakeReader{ReaderFunc: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(fixture)), nil }}
+
+	want := `# HELP passenger_proc_folded Number of processes of an app group past the process limits, exported together with the "other" ID.
+# TYPE passenger_proc_folded gauge
+passenger_proc_folded{app="/srv/app/api",component="/srv/app/api (production)",environment="production",hostname="local-machine",name="/srv/app/api (production)"} 0
+passenger_proc_folded{app="/srv/app/web",component="/srv/app/web (production)",environment="production",hostname="local-machine",name="/srv/app/web (production)"} 1
+# HELP passenger_proc_memory Memory consumed by a process
+# TYPE passenger_proc_memory gauge
+passenger_proc_memory{app="/srv/app/api",component="/srv/app/api (production)",environment="production",hostname="local-machine",id="0",name="/srv/app/api (production)"} 190000
+passenger_proc_memory{app="/srv/app/web",component="/srv/app/web (production)",environment="production",hostname="local-machine",id="0",name="/srv/app/web (production)"} 260000
+passenger_proc_memory{app="/srv/app/web",component="/srv/app/web (production)",environment="production",hostname="local-machine",id="other",name="/srv/app/web (production)"} 255000
+# HELP passenger_requests_processed_total Number of processes served by a process.
+# TYPE passenger_requests_processed_total counter
+passenger_requests_processed_total{app="/srv/app/api",component="/srv/app/api (production)",environment="production",hostname="local-machine",id="0",name="/srv/app/api (production)"} 900
+passenger_requests_processed_total{app="/srv/app/web",component="/srv/app/web (production)",environment="production",hostname="local-machine",id="0",name="/srv/app/web (production)"} 5120
+`
+	err = testutil.CollectAndCompare(New(reader, WithProcessLimits(ProcessLimits{MaxPerApp: 1})), strings.NewReader(want),
+		"passenger_proc_folded", "passenger_proc_memory", "passenger_requests_processed_total")
+	if err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
+
+func TestCollect_Queues(t *testing.T) {
+	t.Setenv("HOSTNAME", "local-machine")
+	pool := func(apps ...string) []byte {
+		var b strings.Builder
+		b.WriteString(`<info version="3"><get_wait_list_size>0</get_wait_list_size><supergroups>`)
+		for _, app := range apps {
+			fmt.Fprintf(&b, `<supergroup><name>%s</name><get_wait_list_size>0</get_wait_list_size>`, app)
+			fmt.Fprintf(&b, `<group default="true"><name>%s</name><component_name>%s</component_name>`, app, app)
+			b.WriteString(`<get_wait_list_size>25</get_wait_list_size><disable_wait_list_size>1</disable_wait_list_size>`)
+			b.WriteString(`<options><max_request_queue_size>100</max_request_queue_size></options></group></supergroup>`)
+		}
+		b.WriteString(`</supergroups></info>`)
+		return []byte(b.String())
+	}
+
+	data := pool("web", "api")
+	reader := &fakeReader{ReaderFunc: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil }}
+	c := New(reader)
+
+	want := `# HELP passenger_queue_saturation_ratio Requests waiting in the queue of an app group relative to its max request queue size.
+# TYPE passenger_queue_saturation_ratio gauge
+passenger_queue_saturation_ratio{app="api",component="api",environment="",hostname="local-machine",name="api"} 0.25
+passenger_queue_saturation_ratio{app="web",component="web",environment="",hostname="local-machine",name="web"} 0.25
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "passenger_queue_saturation_ratio"); err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+	// 4 levels for toplevel, 3 for every app.
+	if want, got := 7, testutil.CollectAndCount(c, "passenger_queue_requests"); want != got {
+		t.Errorf("expected %d passenger_queue_requests series, got %d", want, got)
+	}
+
+	// Histograms of apps gone are dropped, the others keep counting.
+	data = pool("web")
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather failed: %v", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != "passenger_queue_depth_requests" {
+			continue
+		}
+		if want, got := 4, len(mf.GetMetric()); want != got {
+			t.Errorf("expected %d queue depth histograms, got %d", want, got)
+		}
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["name"] == "api" {
+				t.Errorf("expected histograms of api to be dropped")
+			}
+			if labels["level"] == "group" {
+				if want, got := uint64(3), m.GetHistogram().GetSampleCount(); want != got {
+					t.Errorf("expected %d observations, got %d", want, got)
+				}
+				if want, got := 75.0, m.GetHistogram().GetSampleSum(); want != got {
+					t.Errorf("expected sum %v, got %v", want, got)
+				}
+			}
+		}
+	}
+}
+
+func TestCollect_ReadInterval(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/synthetic_passenger6_xml_output.xml")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	reads := 0
+	reader := &fakeReader{ReaderFunc: func() (io.ReadCloser, error) {
+		reads++
+		return io.NopCloser(bytes.NewReader(fixture)), nil
+	}}
+	c := New(reader, WithReadInterval(time.Minute))
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+
+	// observations returns the number of toplevel queue depth observations.
+	observations := func() uint64 {
+		t.Helper()
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("gather failed: %v", err)
+		}
+		for _, mf := range families {
+			if mf.GetName() != "passenger_queue_depth_requests" {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				for _, label := range m.GetLabel() {
+					if label.GetName() == "level" && label.GetValue() == "toplevel" {
+						return m.GetHistogram().GetSampleCount()
+					}
+				}
+			}
+		}
+		t.Fatalf("no toplevel queue depth histogram")
+		return 0
+	}
+
+	// Two gathers of one snapshot observe it once.
+	observations()
+	if got := observations(); got != 1 || reads != 1 {
+		t.Errorf("expected 1 read and 1 observation, got %d reads and %d observations", reads, got)
+	}
+	now = now.Add(time.Minute)
+	if got := observations(); got != 2 || reads != 2 {
+		t.Errorf("expected 2 reads and 2 observations, got %d reads and %d observations", reads, got)
+	}
+}
+
+func TestCollect_Labels(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/synthetic_passenger4_xml_output.xml")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	t.Setenv("HOSTNAME", "local-machine")
+	reader := &fakeReader{ReaderFunc: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(fixture)), nil }}
+
+	for _, tc := range []struct {
+		name    string
+		options []Option
+		// labels are the constant labels every metric is expected to have.
+		labels map[string]string
+	}{
+		{name: "default", labels: map[string]string{"hostname": "local-machine"}},
+		{name: "hostname override", options: []Option{WithHostname("web-1")}, labels: map[string]string{"hostname": "web-1"}},
+		{name: "without hostname", options: []Option{WithoutHostname()}, labels: map[string]string{}},
+		{
+			name:    "const labels",
+			options: []Option{WithConstLabels(prometheus.Labels{"datacenter": "fra1", "role": "web"})},
+			labels:  map[string]string{"hostname": "local-machine", "datacenter": "fra1", "role": "web"},
+		},
+		{
+			name:    "const label overriding hostname",
+			options: []Option{WithoutHostname(), WithConstLabels(prometheus.Labels{"hostname": "web-2"})},
+			labels:  map[string]string{"hostname": "web-2"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			if err := reg.Register(New(reader, tc.options...)); err != nil {
+				t.Fatalf("unexpected register error: %v", err)
+			}
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatalf("unexpected gather error: %v", err)
+			}
+			for _, mf := range families {
+				for _, m := range mf.GetMetric() {
+					labels := make(map[string]string)
+					for _, label := range m.GetLabel() {
+						labels[label.GetName()] = label.GetValue()
+					}
+					for name, value := range tc.labels {
+						if labels[name] != value {
+							t.Errorf("expected %s to have label %s=%q, got %v", mf.GetName(), name, value, labels)
+						}
+					}
+					if _, ok := tc.labels["hostname"]; !ok && labels["hostname"] != "" {
+						t.Errorf("expected %s to have no hostname label, got %v", mf.GetName(), labels)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCollect_InvalidConstLabels(t *testing.T) {
+	c := New(&fakeReader{}, WithConstLabels(prometheus.Labels{"name": "web"}))
+	if err := prometheus.NewRegistry().Register(c); err == nil {
+		t.Errorf("expected a const label clashing with a variable label to fail registration")
+	}
+}
+
+func TestCollect_UnknownSchema(t *testing.T) {
+	data := []byte(`<info version="9"><passenger_version>9.0.0</passenger_version></info>`)
+	reader := &fakeReader{ReaderFunc: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil }}
+
+	var logs bytes.Buffer
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(New(reader, WithLogger(promslog.New(&promslog.Config{Writer: &logs}))))
+
+	for range 2 {
+		if _, err := reg.Gather(); err != nil {
+			t.Fatalf("unexpected gather error: %v", err)
+		}
+	}
+	if want, got := 1, strings.Count(logs.String(), "Unknown pool.xml schema version"); want != got {
+		t.Errorf("expected %d warning, got %d: %s", want, got, logs.String())
+	}
+	if !strings.Contains(logs.String(), "schema_version=9") {
+		t.Errorf("expected warning to name the schema version, got %s", logs.String())
+	}
+}
+
+// orderObserver records the times of the pools it observes.
+type orderObserver struct {
+	mu    sync.Mutex
+	times []time.Time
+}
+
+func (o *orderObserver) Observe(at time.Time, _ *Info) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.times = append(o.times, at)
+}
+
+func TestCollect_ConcurrentObserverOrder(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/synthetic_passenger6_xml_output.xml")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	reader := &fakeReader{ReaderFunc: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(fixture)), nil }}
+	observer := &orderObserver{}
+	c := New(reader, WithObserver(observer))
+	var ticks atomic.Int64
+	c.now = func() time.Time { return time.Unix(ticks.Add(1), 0) }
+
+	var scrapes sync.WaitGroup
+	for range 20 {
+		scrapes.Go(func() { testutil.CollectAndCount(c) })
+	}
+	scrapes.Wait()
+
+	if len(observer.times) != 20 {
+		t.Fatalf("expected 20 observed pools, got %d", len(observer.times))
+	}
+	if !slices.IsSortedFunc(observer.times, time.Time.Compare) {
+		t.Errorf("expected pools to be observed in the order they were read, got %v", observer.times)
+	}
+}
+
+func TestLastScrape(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/passenger_xml_output.xml")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	readErr := fmt.Errorf("fake")
+	reader := &fakeReader{ReaderFunc: func() (io.ReadCloser, error) { return nil, readErr }}
+	c := New(reader)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+
+	if at, err := c.LastScrape(); !at.IsZero() || err != nil {
+		t.Errorf("expected no scrape, got %v, %v", at, err)
+	}
+
+	reg.Gather()
+	if at, err := c.LastScrape(); at.IsZero() || err != readErr {
+		t.Errorf("expected failed scrape, got %v, %v", at, err)
+	}
+
+	reader.ReaderFunc = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(fixture)), nil }
+	reg.Gather()
+	if at, err := c.LastScrape(); at.IsZero() || err != nil {
+		t.Errorf("expected successful scrape, got %v, %v", at, err)
+	}
+}
+
 // The below code was copied from https://github.com/stuartnelson3/passenger_exporter/blob/80b16566cdab445f6e68f967019a95b67f608aca/main_test.go
 
 type updateProcessSpec struct {
@@ -0,0 +1,152 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// groupState is what the collector remembers about a group between scrapes.
+type groupState struct {
+	app, component string
+
+	// pids are the PIDs of the last scrape, restartPIDs the ones the
+	// rolling restart in progress is replacing.
+	pids        map[string]bool
+	restartPIDs map[string]bool
+
+	// spawnerCreated is the creation time of the newest spawner seen, in
+	// microseconds.
+	spawnerCreated     int64
+	spawnerRecreations int
+}
+
+// groupStats are derived from a group and what was remembered about it.
+type groupStats struct {
+	restartProgress    float64
+	spawnerRecreations float64
+}
+
+// observeGroup remembers group of app and derives its stats.
+func (c *Collector) observeGroup(app string, group *Group) groupStats {
+	current := make(map[string]bool, len(group.Processes))
+	for _, proc := range group.Processes {
+		current[proc.PID] = true
+	}
+	spawnerCreated := newest(group.Processes, func(p *Process) string { return p.SpawnerCreationTime })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state, ok := c.groups[group.Name]
+	if !ok {
+		state = &groupState{app: app, component: group.ComponentName, pids: current, spawnerCreated: spawnerCreated}
+		c.groups[group.Name] = state
+	}
+
+	if spawnerCreated > state.spawnerCreated {
+		if state.spawnerCreated != 0 {
+			state.spawnerRecreations++
+		}
+		state.spawnerCreated = spawnerCreated
+	}
+
+	stats := groupStats{
+		restartProgress:    state.restartProgress(group, current),
+		spawnerRecreations: float64(state.spawnerRecreations),
+	}
+	state.pids = current
+	return stats
+}
+
+// restartProgress returns the share of the processes of group replaced by its
+// rolling restart in progress, or 1 if there is none. The processes replaced
+// are the ones of the last scrape before the restart was observed, so
+// progress made before the first scrape counts as not yet made.
+func (s *groupState) restartProgress(group *Group, current map[string]bool) float64 {
+	if group.Restarting != "true" {
+		s.restartPIDs = nil
+		return 1
+	}
+	if s.restartPIDs == nil {
+		s.restartPIDs = s.pids
+	}
+	if len(s.restartPIDs) == 0 {
+		return 1
+	}
+
+	replaced := 0
+	for pid := range s.restartPIDs {
+		if !current[pid] {
+			replaced++
+		}
+	}
+	return float64(replaced) / float64(len(s.restartPIDs))
+}
+
+// forgetGroups drops the state and queue depth histograms of groups and apps
+// no longer in the pool.
+func (c *Collector) forgetGroups(groups map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	apps := make(map[string]bool)
+	for name, state := range c.groups {
+		if groups[name] {
+			apps[state.app] = true
+		}
+	}
+	for name, state := range c.groups {
+		if groups[name] {
+			continue
+		}
+		delete(c.groups, name)
+		if apps[state.app] {
+			c.queueDepth.DeletePartialMatch(prometheus.Labels{"name": state.app, "component": state.component})
+		} else {
+			c.queueDepth.DeletePartialMatch(prometheus.Labels{"name": state.app})
+		}
+	}
+}
+
+// spawnerPresent estimates whether group has a preloader at now. Only smart
+// spawning uses one, which Passenger shuts down when no process was spawned
+// for the max preloader idle time.
+func spawnerPresent(group *Group, now time.Time) bool {
+	if group.Options.SpawnMethod != "smart" {
+		return false
+	}
+	lastSpawn := newest(group.Processes, func(p *Process) string { return p.SpawnEndTime })
+	if lastSpawn == 0 {
+		return false
+	}
+	idle, err := strconv.ParseInt(group.Options.MaxPreloaderIdleTime, 10, 64)
+	if err != nil || idle == 0 {
+		return true
+	}
+	return now.Sub(time.UnixMicro(lastSpawn)) < time.Duration(idle)*time.Second
+}
+
+// newest returns the latest of the microsecond timestamps field returns for
+// processes, or 0 if there is none.
+func newest(processes []Process, field func(*Process) string) int64 {
+	var latest int64
+	for i := range processes {
+		if t, err := strconv.ParseInt(field(&processes[i]), 10, 64); err == nil && t > latest {
+			latest = t
+		}
+	}
+	return latest
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSpawnerPresent(t *testing.T) {
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	spawnedAgo := func(d time.Duration) []Process {
+		return []Process{{SpawnEndTime: strconv.FormatInt(now.Add(-d).UnixMicro(), 10)}}
+	}
+
+	for _, tc := range []struct {
+		name      string
+		method    string
+		idle      string
+		processes []Process
+		want      bool
+	}{
+		{name: "smart, spawned recently", method: "smart", idle: "300", processes: spawnedAgo(time.Minute), want: true},
+		{name: "smart, idle for too long", method: "smart", idle: "300", processes: spawnedAgo(10 * time.Minute), want: false},
+		{name: "smart, never shut down", method: "smart", idle: "0", processes: spawnedAgo(24 * time.Hour), want: true},
+		{name: "smart, no processes", method: "smart", idle: "300", want: false},
+		{name: "direct", method: "direct", idle: "300", processes: spawnedAgo(time.Minute), want: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			group := &Group{
+				Options:   Options{SpawnMethod: tc.method, MaxPreloaderIdleTime: tc.idle},
+				Processes: tc.processes,
+			}
+			if got := spawnerPresent(group, now); got != tc.want {
+				t.Errorf("expected spawner present %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestObserveGroup_SpawnerRecreations(t *testing.T) {
+	c := New(&fakeReader{})
+	group := func(spawnerCreated ...string) *Group {
+		g := &Group{Name: "/srv/app/my_app (production)"}
+		for i, created := range spawnerCreated {
+			g.Processes = append(g.Processes, Process{PID: strconv.Itoa(i), SpawnerCreationTime: created})
+		}
+		return g
+	}
+
+	for i, tc := range []struct {
+		group *Group
+		want  float64
+	}{
+		{group: group("1000", "1000"), want: 0},
+		{group: group("1000", "1000"), want: 0},
+		{group: group("1000", "2000"), want: 1},
+		{group: group(), want: 1},
+		{group: group("2000"), want: 1},
+		{group: group("3000"), want: 2},
+	} {
+		if got := c.observeGroup("/srv/app/my_app (production)", tc.group).spawnerRecreations; got != tc.want {
+			t.Errorf("scrape %d: expected %v recreations, got %v", i, tc.want, got)
+		}
+	}
+
+	c.forgetGroups(map[string]bool{})
+	if got := c.observeGroup("/srv/app/my_app (production)", group("4000")).spawnerRecreations; got != 0 {
+		t.Errorf("expected recreations to restart from 0 for a forgotten group, got %v", got)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/nex-health/passenger-exporter/collector"
+	"github.com/nex-health/passenger-exporter/passengertest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollect_RollingRestart(t *testing.T) {
+	sim := passengertest.NewSimulation(
+		passengertest.Spec{Apps: 2, ProcessesPerApp: 4},
+		passengertest.RollingRestart(0, 2, 1),
+	)
+
+	inst := passengertest.New(t)
+	c := collector.New(collector.NewUDSReader(inst.Registry))
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+
+	for step := 0; step < 8; step++ {
+		sim.Step()
+		data, err := passengertest.MarshalXML(sim.Info())
+		if err != nil {
+			t.Fatalf("marshal failed: %v", err)
+		}
+		inst.SetPoolXML(data)
+
+		if _, err := reg.Gather(); err != nil {
+			t.Fatalf("step %d: collect failed: %v", step, err)
+		}
+		// Replaced processes take over the slot of the ones they replace,
+		// so the number of series stays put.
+		if want, got := 8, testutil.CollectAndCount(c, "passenger_proc_memory"); want != got {
+			t.Errorf("step %d: expected %d passenger_proc_memory series, got %d", step, want, got)
+		}
+	}
+}
+
+func TestCollect_EnterpriseRollingRestart(t *testing.T) {
+	sim := passengertest.NewSimulation(
+		passengertest.Spec{Apps: 1, ProcessesPerApp: 4, Enterprise: true},
+		passengertest.RollingRestart(0, 2, 1),
+	)
+	c := collector.New(sim)
+
+	var progress, detached []float64
+	for step := 0; step < 6; step++ {
+		sim.Step()
+		metrics := gather(t, c)
+		progress = append(progress, metrics["passenger_app_group_restart_progress_ratio"])
+		detached = append(detached, metrics["passenger_app_group_detached_processes"])
+	}
+
+	if want := []float64{1, 0.25, 0.5, 0.75, 1, 1}; !reflect.DeepEqual(want, progress) {
+		t.Errorf("expected restart progress %v, got %v", want, progress)
+	}
+	if want := []float64{0, 1, 1, 1, 1, 0}; !reflect.DeepEqual(want, detached) {
+		t.Errorf("expected detached processes %v, got %v", want, detached)
+	}
+}
+
+// gather collects c and returns the value of the first series of every
+// metric.
+func gather(t *testing.T, c prometheus.Collector) map[string]float64 {
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("collect failed: %v", err)
+	}
+
+	values := make(map[string]float64)
+	for _, mf := range families {
+		m := mf.GetMetric()[0]
+		switch {
+		case m.GetGauge() != nil:
+			values[mf.GetName()] = m.GetGauge().GetValue()
+		case m.GetCounter() != nil:
+			values[mf.GetName()] = m.GetCounter().GetValue()
+		}
+	}
+	return values
+}
+
+func BenchmarkCollect(b *testing.B) {
+	for _, spec := range []passengertest.Spec{
+		{Apps: 1, ProcessesPerApp: 48},
+		{Apps: 10, ProcessesPerApp: 50},
+		{Apps: 50, ProcessesPerApp: 20},
+	} {
+		b.Run(fmt.Sprintf("apps=%d/processes=%d", spec.Apps, spec.ProcessesPerApp), func(b *testing.B) {
+			c := collector.New(passengertest.NewSimulation(spec))
+			reg := prometheus.NewRegistry()
+			reg.MustRegister(c)
+
+			series := 0
+			for b.Loop() {
+				families, err := reg.Gather()
+				if err != nil {
+					b.Fatalf("gather failed: %v", err)
+				}
+				series = 0
+				for _, mf := range families {
+					series += len(mf.GetMetric())
+				}
+			}
+			b.ReportMetric(float64(series), "series")
+		})
+	}
+}
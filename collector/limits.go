@@ -0,0 +1,103 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// Orderings of processes deciding which ones keep their own series.
+const (
+	LimitByMemory   = "memory"
+	LimitBySessions = "sessions"
+)
+
+// LimitOrderings are the valid values of ProcessLimits.By.
+var LimitOrderings = []string{LimitByMemory, LimitBySessions}
+
+// ProcessLimits caps the number of processes exported with their own series.
+// The processes past the caps are folded into a series with the "other" ID per
+// app group. Zero caps are unlimited.
+type ProcessLimits struct {
+	// Max caps the processes of all apps, MaxPerApp the ones of each app.
+	Max       int
+	MaxPerApp int
+	// By is one of LimitOrderings, defaulting to LimitByMemory. The
+	// processes using the most keep their own series.
+	By string
+}
+
+func (l *ProcessLimits) enabled() bool {
+	return l.Max > 0 || l.MaxPerApp > 0
+}
+
+type processKey struct {
+	group, pid string
+}
+
+type rankedProcess struct {
+	key   processKey
+	value float64
+}
+
+// fold returns the processes of info past the limits.
+func (l *ProcessLimits) fold(info *Info) map[processKey]bool {
+	folded := make(map[processKey]bool)
+	if !l.enabled() {
+		return folded
+	}
+
+	var kept []rankedProcess
+	for _, sg := range info.SuperGroups {
+		var app []rankedProcess
+		for _, group := range sg.Groups {
+			for i := range group.Processes {
+				app = append(app, rankedProcess{
+					key:   processKey{group.Name, group.Processes[i].PID},
+					value: l.value(&group.Processes[i]),
+				})
+			}
+		}
+		kept = append(kept, l.keep(app, l.MaxPerApp, folded)...)
+	}
+	l.keep(kept, l.Max, folded)
+	return folded
+}
+
+// keep returns the top n of processes, adding the rest to folded.
+func (l *ProcessLimits) keep(processes []rankedProcess, n int, folded map[processKey]bool) []rankedProcess {
+	if n <= 0 || len(processes) <= n {
+		return processes
+	}
+	slices.SortStableFunc(processes, func(a, b rankedProcess) int {
+		return cmp.Compare(b.value, a.value)
+	})
+	for _, p := range processes[n:] {
+		folded[p.key] = true
+	}
+	return processes[:n]
+}
+
+func (l *ProcessLimits) value(proc *Process) float64 {
+	v := parseFloat(proc.RealMemory)
+	if l.By == LimitBySessions {
+		v = parseFloat(proc.Sessions)
+	}
+	if math.IsNaN(v) {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,76 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestProcessLimits_Fold(t *testing.T) {
+	// Processes are given as PID, memory and sessions.
+	app := func(name string, processes ...[3]string) SuperGroup {
+		group := Group{Name: name}
+		for _, p := range processes {
+			group.Processes = append(group.Processes, Process{PID: p[0], RealMemory: p[1], Sessions: p[2]})
+		}
+		return SuperGroup{Name: name, Groups: []Group{group}}
+	}
+	info := &Info{SuperGroups: []SuperGroup{
+		app("web", [3]string{"1", "300", "0"}, [3]string{"2", "100", "1"}, [3]string{"3", "200", "0"}),
+		app("api", [3]string{"4", "400", "0"}, [3]string{"5", "50", "2"}),
+	}}
+
+	for _, tc := range []struct {
+		name   string
+		limits ProcessLimits
+		want   []processKey
+	}{
+		{name: "unlimited", limits: ProcessLimits{}},
+		{
+			name:   "per app",
+			limits: ProcessLimits{MaxPerApp: 2},
+			want:   []processKey{{"web", "2"}},
+		},
+		{
+			name:   "global",
+			limits: ProcessLimits{Max: 2},
+			want:   []processKey{{"api", "5"}, {"web", "2"}, {"web", "3"}},
+		},
+		{
+			name:   "per app then global",
+			limits: ProcessLimits{Max: 3, MaxPerApp: 1},
+			want:   []processKey{{"api", "5"}, {"web", "2"}, {"web", "3"}},
+		},
+		{
+			name:   "by sessions",
+			limits: ProcessLimits{MaxPerApp: 1, By: LimitBySessions},
+			want:   []processKey{{"api", "4"}, {"web", "1"}, {"web", "3"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := slices.SortedFunc(maps.Keys(tc.limits.fold(info)), func(a, b processKey) int {
+				if a.group != b.group {
+					return strings.Compare(a.group, b.group)
+				}
+				return strings.Compare(a.pid, b.pid)
+			})
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("expected %v to be folded, got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"math"
+	"time"
+)
+
+// bytesPerKilobyte converts real_memory, which Passenger reports in
+// kilobytes.
+const bytesPerKilobyte = 1024
+
+type memorySample struct {
+	at    time.Time
+	bytes float64
+}
+
+// observeMemory remembers the memory of the processes of info at now and
+// returns the growth rate of the ones sampled over at least half the memory
+// growth window, in bytes per second by PID. Unlike deriv() over slot IDs,
+// the samples of a process never mix with the ones of the process it replaced.
+func (c *Collector) observeMemory(info *Info, now time.Time) map[string]float64 {
+	growth := make(map[string]float64)
+	if c.memoryWindow <= 0 {
+		return growth
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seen := make(map[string]bool)
+	for _, sg := range info.SuperGroups {
+		for _, group := range sg.Groups {
+			for _, proc := range group.Processes {
+				seen[proc.PID] = true
+				memory := parseFloat(proc.RealMemory)
+				if math.IsNaN(memory) {
+					continue
+				}
+
+				samples := append(c.memory[proc.PID], memorySample{at: now, bytes: memory * bytesPerKilobyte})
+				for len(samples) > 0 && now.Sub(samples[0].at) > c.memoryWindow {
+					samples = samples[1:]
+				}
+				c.memory[proc.PID] = samples
+				if now.Sub(samples[0].at) >= c.memoryWindow/2 {
+					growth[proc.PID] = slope(samples)
+				}
+			}
+		}
+	}
+	for pid := range c.memory {
+		if !seen[pid] {
+			delete(c.memory, pid)
+		}
+	}
+	return growth
+}
+
+// slope returns the slope of the least squares fit of samples, in bytes per
+// second.
+func slope(samples []memorySample) float64 {
+	var meanT, meanBytes float64
+	for _, s := range samples {
+		meanT += s.at.Sub(samples[0].at).Seconds()
+		meanBytes += s.bytes
+	}
+	meanT /= float64(len(samples))
+	meanBytes /= float64(len(samples))
+
+	var cov, variance float64
+	for _, s := range samples {
+		dt := s.at.Sub(samples[0].at).Seconds() - meanT
+		cov += dt * (s.bytes - meanBytes)
+		variance += dt * dt
+	}
+	if variance == 0 {
+		return 0
+	}
+	return cov / variance
+}
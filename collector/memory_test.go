@@ -0,0 +1,111 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSlope(t *testing.T) {
+	start := time.Unix(0, 0)
+	for _, tc := range []struct {
+		name    string
+		samples []memorySample
+		want    float64
+	}{
+		{name: "single sample", samples: []memorySample{{start, 100}}, want: 0},
+		{name: "flat", samples: []memorySample{{start, 100}, {start.Add(time.Second), 100}}, want: 0},
+		{
+			name:    "linear",
+			samples: []memorySample{{start, 100}, {start.Add(10 * time.Second), 200}, {start.Add(20 * time.Second), 300}},
+			want:    10,
+		},
+		{
+			name:    "noisy",
+			samples: []memorySample{{start, 100}, {start.Add(10 * time.Second), 300}, {start.Add(20 * time.Second), 300}},
+			want:    10,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := slope(tc.samples); got != tc.want {
+				t.Errorf("expected slope %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCollect_MemoryGrowth(t *testing.T) {
+	t.Setenv("HOSTNAME", "local-machine")
+	// Processes are given as PID and real memory in kilobytes.
+	pool := func(processes ...[2]int) []byte {
+		var b strings.Builder
+		b.WriteString(`<info version="3"><supergroups><supergroup><name>web</name>`)
+		b.WriteString(`<group default="true"><name>web</name><component_name>web</component_name><processes>`)
+		for _, p := range processes {
+			fmt.Fprintf(&b, `<process><pid>%d</pid><real_memory>%d</real_memory></process>`, p[0], p[1])
+		}
+		b.WriteString(`</processes></group></supergroup></supergroups></info>`)
+		return []byte(b.String())
+	}
+
+	var data []byte
+	reader := &fakeReader{ReaderFunc: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil }}
+	c := New(reader, WithMemoryGrowth(time.Minute, 512))
+	now := time.Unix(1714989600, 0)
+	c.now = func() time.Time { return now }
+
+	// PID 1 grows by 15 kB every 15s scrape, PID 2 stays flat.
+	for i := range 5 {
+		data = pool([2]int{1, 100000 + 15*i}, [2]int{2, 100000})
+		testutil.CollectAndCount(c)
+		now = now.Add(15 * time.Second)
+	}
+	data = pool([2]int{1, 100075}, [2]int{2, 100000})
+	want := `# HELP passenger_app_leaking_workers Number of processes of an app whose memory grows faster than the leak threshold.
+# TYPE passenger_app_leaking_workers gauge
+passenger_app_leaking_workers{app="web",environment="",hostname="local-machine",name="web"} 1
+# HELP passenger_proc_memory_growth_bytes_per_second Growth rate of the memory of a process over the memory growth window, fitted by linear regression.
+# TYPE passenger_proc_memory_growth_bytes_per_second gauge
+passenger_proc_memory_growth_bytes_per_second{app="web",component="web",environment="",hostname="local-machine",id="0",name="web"} 1024
+passenger_proc_memory_growth_bytes_per_second{app="web",component="web",environment="",hostname="local-machine",id="1",name="web"} 0
+`
+	err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"passenger_app_leaking_workers", "passenger_proc_memory_growth_bytes_per_second")
+	if err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+
+	// The samples of PID 1 do not carry over to the process taking its slot.
+	now = now.Add(15 * time.Second)
+	data = pool([2]int{2, 100000}, [2]int{3, 300000})
+	want = `# HELP passenger_app_leaking_workers Number of processes of an app whose memory grows faster than the leak threshold.
+# TYPE passenger_app_leaking_workers gauge
+passenger_app_leaking_workers{app="web",environment="",hostname="local-machine",name="web"} 0
+# HELP passenger_proc_memory_growth_bytes_per_second Growth rate of the memory of a process over the memory growth window, fitted by linear regression.
+# TYPE passenger_proc_memory_growth_bytes_per_second gauge
+passenger_proc_memory_growth_bytes_per_second{app="web",component="web",environment="",hostname="local-machine",id="0",name="web"} 0
+`
+	err = testutil.CollectAndCompare(c, strings.NewReader(want),
+		"passenger_app_leaking_workers", "passenger_proc_memory_growth_bytes_per_second")
+	if err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
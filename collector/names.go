@@ -0,0 +1,115 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Sources of the app label.
+const (
+	// NameSourceName takes the app from the name of the supergroup, e.g.
+	// "/var/www/shop/current (production)".
+	NameSourceName = "name"
+	// NameSourceAppGroupName takes the app from the app_group_name option,
+	// which can be set with passenger_app_group_name.
+	NameSourceAppGroupName = "app_group_name"
+	// NameSourceAppRoot takes the app from the app root.
+	NameSourceAppRoot = "app_root"
+)
+
+// NameSources are the valid values of AppNamer.Source.
+var NameSources = []string{NameSourceName, NameSourceAppGroupName, NameSourceAppRoot}
+
+var (
+	// environmentSuffix is how Passenger 5 and later append the environment
+	// to the name of an app.
+	environmentSuffix = regexp.MustCompile(`^(.*) \(([^()]*)\)$`)
+	// releaseDir matches the directories Capistrano deploys to, which
+	// change on every deploy.
+	releaseDir = regexp.MustCompile(`/(current|releases/[^/]+)/?$`)
+)
+
+// Rewrite replaces matches of Pattern in an app name with Replacement, which
+// can refer to submatches like regexp.Regexp.ReplaceAllString.
+type Rewrite struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// ParseRewrite parses a rewrite in the REGEX=REPLACEMENT form. The regex
+// ends at the last "=".
+func ParseRewrite(s string) (Rewrite, error) {
+	i := strings.LastIndex(s, "=")
+	if i < 0 {
+		return Rewrite{}, fmt.Errorf("rewrite %q is not in the REGEX=REPLACEMENT form", s)
+	}
+	pattern, err := regexp.Compile(s[:i])
+	if err != nil {
+		return Rewrite{}, fmt.Errorf("rewrite %q: %w", s, err)
+	}
+	return Rewrite{Pattern: pattern, Replacement: s[i+1:]}, nil
+}
+
+// AppNamer derives the app and environment labels of an app from its
+// supergroup. The zero value names apps after their supergroup.
+type AppNamer struct {
+	// Source is one of NameSources, defaulting to NameSourceName.
+	Source string
+	// Roots maps app roots to app names, taking precedence over the rest.
+	Roots map[string]string
+	// Rewrites are applied in order to the name taken from Source.
+	Rewrites []Rewrite
+}
+
+// Name returns the app and environment labels of sg. The environment is the
+// one of the default group, falling back to the one in the name.
+func (n *AppNamer) Name(sg *SuperGroup) (app, environment string) {
+	group := sg.DefaultGroup()
+	if group == nil {
+		group = &Group{}
+	}
+
+	app = sg.Name
+	switch n.Source {
+	case NameSourceAppGroupName:
+		if group.Options.AppGroupName != "" {
+			app = group.Options.AppGroupName
+		}
+	case NameSourceAppRoot:
+		if group.AppRoot != "" {
+			app = group.AppRoot
+		}
+	}
+
+	// Passenger 4 names groups after their component.
+	app, _, _ = strings.Cut(app, "#")
+	if m := environmentSuffix.FindStringSubmatch(app); m != nil {
+		app, environment = m[1], m[2]
+	}
+	if group.Environment != "" {
+		environment = group.Environment
+	}
+
+	if name, ok := n.Roots[group.AppRoot]; ok && group.AppRoot != "" {
+		return name, environment
+	}
+	app = releaseDir.ReplaceAllString(app, "")
+	for _, rewrite := range n.Rewrites {
+		app = rewrite.Pattern.ReplaceAllString(app, rewrite.Replacement)
+	}
+	return app, environment
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+)
+
+func TestAppNamer(t *testing.T) {
+	superGroup := func(name, root, appGroupName, environment string) *SuperGroup {
+		return &SuperGroup{Name: name, Groups: []Group{{
+			Name:        name,
+			AppRoot:     root,
+			Environment: environment,
+			Options:     Options{AppGroupName: appGroupName},
+		}}}
+	}
+	mustRewrite := func(s string) Rewrite {
+		rewrite, err := ParseRewrite(s)
+		if err != nil {
+			t.Fatalf("unexpected error parsing rewrite: %v", err)
+		}
+		return rewrite
+	}
+
+	for _, tc := range []struct {
+		name             string
+		namer            AppNamer
+		sg               *SuperGroup
+		wantApp, wantEnv string
+	}{
+		{
+			name:    "environment suffix",
+			sg:      superGroup("/srv/app/web (production)", "/srv/app/web", "", ""),
+			wantApp: "/srv/app/web", wantEnv: "production",
+		},
+		{
+			name:    "environment of the group",
+			sg:      superGroup("/srv/app/web (production)", "/srv/app/web", "", "staging"),
+			wantApp: "/srv/app/web", wantEnv: "staging",
+		},
+		{
+			name:    "capistrano current",
+			sg:      superGroup("/var/www/shop/current (production)", "/var/www/shop/current", "", "production"),
+			wantApp: "/var/www/shop", wantEnv: "production",
+		},
+		{
+			name:    "capistrano release",
+			sg:      superGroup("/var/www/shop/releases/20240506070809 (production)", "/var/www/shop/releases/20240506070809", "", "production"),
+			wantApp: "/var/www/shop", wantEnv: "production",
+		},
+		{
+			name:    "passenger 4 component",
+			sg:      superGroup("/srv/app/legacy_app#default", "/srv/app/legacy_app", "", "production"),
+			wantApp: "/srv/app/legacy_app", wantEnv: "production",
+		},
+		{
+			name:    "app group name",
+			namer:   AppNamer{Source: NameSourceAppGroupName},
+			sg:      superGroup("/var/www/shop/current (production)", "/var/www/shop/current", "storefront", "production"),
+			wantApp: "storefront", wantEnv: "production",
+		},
+		{
+			name:    "app root",
+			namer:   AppNamer{Source: NameSourceAppRoot},
+			sg:      superGroup("shop (production)", "/var/www/shop/current", "", "production"),
+			wantApp: "/var/www/shop", wantEnv: "production",
+		},
+		{
+			name:    "rewrites in order",
+			namer:   AppNamer{Rewrites: []Rewrite{mustRewrite(`^.*/([^/]+)$=$1`), mustRewrite(`_=-`)}},
+			sg:      superGroup("/var/www/my_shop/current (production)", "/var/www/my_shop/current", "", "production"),
+			wantApp: "my-shop", wantEnv: "production",
+		},
+		{
+			name: "mapped root",
+			namer: AppNamer{
+				Roots:    map[string]string{"/var/www/shop/current": "storefront"},
+				Rewrites: []Rewrite{mustRewrite(`shop=boutique`)},
+			},
+			sg:      superGroup("/var/www/shop/current (production)", "/var/www/shop/current", "", "production"),
+			wantApp: "storefront", wantEnv: "production",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			app, env := tc.namer.Name(tc.sg)
+			if app != tc.wantApp || env != tc.wantEnv {
+				t.Errorf("expected app %q in %q, got %q in %q", tc.wantApp, tc.wantEnv, app, env)
+			}
+		})
+	}
+}
+
+func TestParseRewrite(t *testing.T) {
+	rewrite, err := ParseRewrite(`^(?:a=b)+$=c`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rewrite.Pattern.String() != `^(?:a=b)+$` || rewrite.Replacement != "c" {
+		t.Errorf("expected the regex to end at the last =, got %q and %q", rewrite.Pattern, rewrite.Replacement)
+	}
+
+	for _, s := range []string{"no-separator", "(=x"} {
+		if _, err := ParseRewrite(s); err == nil {
+			t.Errorf("expected an error parsing %q", s)
+		}
+	}
+}
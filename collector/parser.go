@@ -16,10 +16,12 @@ package collector
 import (
 	"encoding/xml"
 	"io"
+	"strings"
 
 	"golang.org/x/net/html/charset"
 )
 
+// Parse decodes pool.xml, deriving the counts it lacks.
 func Parse(r io.Reader) (*Info, error) {
 	var info *Info
 
@@ -28,6 +30,246 @@ func Parse(r io.Reader) (*Info, error) {
 	if err := decoder.Decode(&info); err != nil {
 		return nil, err
 	}
+	deriveCounts(info)
 
 	return info, nil
 }
+
+// The fields ParseStream materializes, by element name. Everything else,
+// including the potentially huge command lines, is skipped.
+var (
+	streamInfoFields = map[string]func(*Info, string){
+		"passenger_version":  func(i *Info, v string) { i.PassengerVersion = v },
+		"group_count":        func(i *Info, v string) { i.AppCount = v },
+		"process_count":      func(i *Info, v string) { i.CurrentProcessCount = v },
+		"max":                func(i *Info, v string) { i.MaxProcessCount = v },
+		"capacity_used":      func(i *Info, v string) { i.CapacityUsed = v },
+		"get_wait_list_size": func(i *Info, v string) { i.TopLevelRequestsInQueue = v },
+	}
+	streamSuperGroupFields = map[string]func(*SuperGroup, string){
+		"name":               func(sg *SuperGroup, v string) { sg.Name = v },
+		"state":              func(sg *SuperGroup, v string) { sg.State = v },
+		"capacity_used":      func(sg *SuperGroup, v string) { sg.CapacityUsed = v },
+		"get_wait_list_size": func(sg *SuperGroup, v string) { sg.RequestsInQueue = v },
+	}
+	streamGroupFields = map[string]func(*Group, string){
+		"name":                    func(g *Group, v string) { g.Name = v },
+		"component_name":          func(g *Group, v string) { g.ComponentName = v },
+		"app_root":                func(g *Group, v string) { g.AppRoot = v },
+		"app_type":                func(g *Group, v string) { g.AppType = v },
+		"environment":             func(g *Group, v string) { g.Environment = v },
+		"get_wait_list_size":      func(g *Group, v string) { g.GetWaitListSize = v },
+		"processes_being_spawned": func(g *Group, v string) { g.ProcessesSpawning = v },
+		"disable_wait_list_size":  func(g *Group, v string) { g.DisableWaitListSize = v },
+		"restarting":              func(g *Group, v string) { g.Restarting = v },
+		"restarts_initiated":      func(g *Group, v string) { g.RestartsInitiated = v },
+		"life_status":             func(g *Group, v string) { g.LifeStatus = v },
+		"capacity_used":           func(g *Group, v string) { g.CapacityUsed = v },
+	}
+	streamOptionsFields = map[string]func(*Options, string){
+		"app_group_name":          func(o *Options, v string) { o.AppGroupName = v },
+		"spawn_method":            func(o *Options, v string) { o.SpawnMethod = v },
+		"sticky_sessions":         func(o *Options, v string) { o.StickySessions = v },
+		"max_preloader_idle_time": func(o *Options, v string) { o.MaxPreloaderIdleTime = v },
+		"max_request_queue_size":  func(o *Options, v string) { o.MaxRequestQueueSize = v },
+	}
+	streamProcessFields = map[string]func(*Process, string){
+		"pid":                   func(p *Process, v string) { p.PID = v },
+		"gupid":                 func(p *Process, v string) { p.GUPID = v },
+		"sticky_session_id":     func(p *Process, v string) { p.StickySessionID = v },
+		"real_memory":           func(p *Process, v string) { p.RealMemory = v },
+		"processed":             func(p *Process, v string) { p.RequestsProcessed = v },
+		"sessions":              func(p *Process, v string) { p.Sessions = v },
+		"concurrency":           func(p *Process, v string) { p.Concurrency = v },
+		"busyness":              func(p *Process, v string) { p.Busyness = v },
+		"life_status":           func(p *Process, v string) { p.LifeStatus = v },
+		"enabled":               func(p *Process, v string) { p.Enabled = v },
+		"cpu":                   func(p *Process, v string) { p.CPU = v },
+		"spawner_creation_time": func(p *Process, v string) { p.SpawnerCreationTime = v },
+		"spawn_start_time":      func(p *Process, v string) { p.SpawnStartTime = v },
+		"spawn_end_time":        func(p *Process, v string) { p.SpawnEndTime = v },
+		"last_used":             func(p *Process, v string) { p.LastUsed = v },
+	}
+)
+
+// ParseStream parses pool.xml token by token, materializing only the fields
+// the collector exports. Those fields are identical to what Parse returns,
+// all others are left empty.
+//
+// It reads raw tokens, which saves encoding/xml the namespace bookkeeping
+// pool.xml has no use for, and checks that end elements match their start
+// elements itself.
+func ParseStream(r io.Reader) (*Info, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	var root xml.StartElement
+	for {
+		token, err := decoder.RawToken()
+		if err != nil {
+			return nil, err
+		}
+		if se, ok := token.(xml.StartElement); ok {
+			root = se
+			break
+		}
+	}
+
+	info := &Info{}
+	for _, attr := range root.Attr {
+		if attr.Name.Local == "version" {
+			info.SchemaVersion = attr.Value
+		}
+	}
+
+	err := walkChildren(decoder, root, func(se xml.StartElement) error {
+		if se.Name.Local == "supergroups" {
+			return walkChildren(decoder, se, func(se xml.StartElement) error {
+				if se.Name.Local != "supergroup" {
+					return skip(decoder, se)
+				}
+				sg, err := parseSuperGroup(decoder, se)
+				if err != nil {
+					return err
+				}
+				info.SuperGroups = append(info.SuperGroups, sg)
+				return nil
+			})
+		}
+		return setField(decoder, se, streamInfoFields, info)
+	})
+	if err != nil {
+		return nil, err
+	}
+	deriveCounts(info)
+
+	return info, nil
+}
+
+func parseSuperGroup(decoder *xml.Decoder, start xml.StartElement) (SuperGroup, error) {
+	var sg SuperGroup
+	err := walkChildren(decoder, start, func(se xml.StartElement) error {
+		if se.Name.Local == "group" {
+			group, err := parseGroup(decoder, se)
+			sg.Groups = append(sg.Groups, group)
+			return err
+		}
+		return setField(decoder, se, streamSuperGroupFields, &sg)
+	})
+	return sg, err
+}
+
+func parseGroup(decoder *xml.Decoder, start xml.StartElement) (Group, error) {
+	var group Group
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "default" {
+			group.Default = attr.Value
+		}
+	}
+
+	err := walkChildren(decoder, start, func(se xml.StartElement) error {
+		switch se.Name.Local {
+		case "processes":
+			return parseProcesses(decoder, se, &group.Processes)
+		case "detached_processes":
+			return parseProcesses(decoder, se, &group.DetachedProcesses)
+		case "options":
+			return walkChildren(decoder, se, func(se xml.StartElement) error {
+				return setField(decoder, se, streamOptionsFields, &group.Options)
+			})
+		}
+		return setField(decoder, se, streamGroupFields, &group)
+	})
+	return group, err
+}
+
+func parseProcesses(decoder *xml.Decoder, start xml.StartElement, processes *[]Process) error {
+	return walkChildren(decoder, start, func(se xml.StartElement) error {
+		if se.Name.Local != "process" {
+			return skip(decoder, se)
+		}
+		var proc Process
+		err := walkChildren(decoder, se, func(se xml.StartElement) error {
+			return setField(decoder, se, streamProcessFields, &proc)
+		})
+		*processes = append(*processes, proc)
+		return err
+	})
+}
+
+// walkChildren calls fn for every child element of start, whose start element
+// was just read, up to and including its end element. fn has to consume the
+// child including its end element.
+func walkChildren(decoder *xml.Decoder, start xml.StartElement, fn func(xml.StartElement) error) error {
+	for {
+		token, err := decoder.RawToken()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if err := fn(t); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return checkEnd(decoder, start, t)
+		}
+	}
+}
+
+// setField reads the text of start into the field of v registered under its
+// name, or skips it if there is none.
+func setField[T any](decoder *xml.Decoder, start xml.StartElement, fields map[string]func(*T, string), v *T) error {
+	set, ok := fields[start.Name.Local]
+	if !ok {
+		return skip(decoder, start)
+	}
+
+	// Like Unmarshal does for string fields, only the character data
+	// directly inside the element counts.
+	var text strings.Builder
+	for {
+		token, err := decoder.RawToken()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.StartElement:
+			if err := skip(decoder, t); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if err := checkEnd(decoder, start, t); err != nil {
+				return err
+			}
+			set(v, text.String())
+			return nil
+		}
+	}
+}
+
+// skip consumes start, whose start element was just read, including all
+// its children.
+func skip(decoder *xml.Decoder, start xml.StartElement) error {
+	return walkChildren(decoder, start, func(se xml.StartElement) error {
+		return skip(decoder, se)
+	})
+}
+
+func checkEnd(decoder *xml.Decoder, start xml.StartElement, end xml.EndElement) error {
+	if start.Name != end.Name {
+		line, _ := decoder.InputPos()
+		return &xml.SyntaxError{Msg: "element <" + start.Name.Local + "> closed by </" + end.Name.Local + ">", Line: line}
+	}
+	return nil
+}
+
+// unexpectedEOF turns running out of input inside an element into an error.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -14,8 +14,13 @@
 package collector
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"math"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -39,7 +44,8 @@ func TestParsing(t *testing.T) {
 	}
 
 	for _, sg := range info.SuperGroups {
-		if want, got := "/src/app/my_app", sg.Group.Options.AppRoot; want != got {
+		group := sg.DefaultGroup()
+		if want, got := "/src/app/my_app", group.Options.AppRoot; want != got {
 			t.Fatalf("incorrect app_root: wanted %s, got %s", want, got)
 		}
 
@@ -48,13 +54,264 @@ func TestParsing(t *testing.T) {
 			t.Fatalf("failed to parse requests in queue")
 		}
 
-		if len(sg.Group.Processes) == 0 {
+		if len(group.Processes) == 0 {
 			t.Fatalf("no processes in output")
 		}
-		for _, proc := range sg.Group.Processes {
+		for _, proc := range group.Processes {
 			if want, got := "2254", proc.ProcessGroupID; want != got {
 				t.Fatalf("incorrect process_group_id: wanted %s, got %s", want, got)
 			}
 		}
 	}
 }
+
+func TestParsing_Groups(t *testing.T) {
+	info, err := Parse(bytes.NewReader(mustReadFile(t, "testdata/synthetic_passenger4_xml_output.xml")))
+	if err != nil {
+		t.Fatalf("parse xml file failed: %v", err)
+	}
+
+	sg := info.SuperGroups[0]
+	if want, got := 2, len(sg.Groups); want != got {
+		t.Fatalf("expected %d groups, got %d", want, got)
+	}
+	if want, got := "default", sg.DefaultGroup().ComponentName; want != got {
+		t.Errorf("expected default component %q, got %q", want, got)
+	}
+	if want, got := "/srv/app/legacy_app#worker", sg.Groups[1].Name; want != got {
+		t.Errorf("expected group name %q, got %q", want, got)
+	}
+	if want, got := 1, len(sg.Groups[1].Processes); want != got {
+		t.Errorf("expected %d worker processes, got %d", want, got)
+	}
+
+	// Without a group marked default, the first one is.
+	sg.Groups[0].Default = ""
+	if want, got := &sg.Groups[0], sg.DefaultGroup(); want != got {
+		t.Errorf("expected first group as default")
+	}
+	if got := (&SuperGroup{}).DefaultGroup(); got != nil {
+		t.Errorf("expected no default group, got %v", got)
+	}
+}
+
+// TestParse_Schemas checks the schema versions against a fixture of each
+// Passenger release. Only the 5.0.26 fixture is a capture; the 4.0.60 and
+// 6.0.23 ones were written by hand from it, so they cannot reveal fields
+// mapped differently by those releases. Replace them with the output of
+// `passenger-status --show=xml` of each release when captures are available.
+func TestParse_Schemas(t *testing.T) {
+	for _, tc := range []struct {
+		fixture          string
+		schemaVersion    string
+		passengerVersion string
+		apps             string
+		processes        string
+		groups           int
+	}{
+		{"testdata/synthetic_passenger4_xml_output.xml", SchemaVersion2, "4.0.60", "1", "3", 2},
+		{"testdata/passenger_xml_output.xml", SchemaVersion3, "5.0.26", "1", "48", 1},
+		{"testdata/synthetic_passenger6_xml_output.xml", SchemaVersion3, "6.0.23", "2", "3", 1},
+	} {
+		data := mustReadFile(t, tc.fixture)
+		for name, parse := range map[string]func(io.Reader) (*Info, error){"Parse": Parse, "ParseStream": ParseStream} {
+			t.Run(tc.passengerVersion+"/"+name, func(t *testing.T) {
+				info, err := parse(bytes.NewReader(data))
+				if err != nil {
+					t.Fatalf("parse failed: %v", err)
+				}
+				if !KnownSchema(info.SchemaVersion) {
+					t.Errorf("expected schema version %q to be known", info.SchemaVersion)
+				}
+				if want, got := tc.schemaVersion, info.SchemaVersion; want != got {
+					t.Errorf("expected schema version %q, got %q", want, got)
+				}
+				if want, got := tc.passengerVersion, info.PassengerVersion; want != got {
+					t.Errorf("expected passenger version %q, got %q", want, got)
+				}
+				if want, got := tc.apps, info.AppCount; want != got {
+					t.Errorf("expected app count %q, got %q", want, got)
+				}
+				if want, got := tc.processes, info.CurrentProcessCount; want != got {
+					t.Errorf("expected process count %q, got %q", want, got)
+				}
+				if want, got := tc.groups, len(info.SuperGroups[0].Groups); want != got {
+					t.Errorf("expected %d groups, got %d", want, got)
+				}
+			})
+		}
+	}
+}
+
+func TestParse_UnknownSchema(t *testing.T) {
+	info, err := Parse(strings.NewReader(`<info version="9"><passenger_version>9.0.0</passenger_version><supergroups><supergroup><group/></supergroup></supergroups></info>`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if KnownSchema(info.SchemaVersion) {
+		t.Errorf("expected schema version %q to be unknown", info.SchemaVersion)
+	}
+	if want, got := "0", info.CurrentProcessCount; want != got {
+		t.Errorf("expected derived process count %q, got %q", want, got)
+	}
+}
+
+// usedFields keeps only the fields ParseStream materializes.
+func usedFields(info *Info) *Info {
+	used := &Info{
+		SchemaVersion:           info.SchemaVersion,
+		PassengerVersion:        info.PassengerVersion,
+		AppCount:                info.AppCount,
+		CurrentProcessCount:     info.CurrentProcessCount,
+		MaxProcessCount:         info.MaxProcessCount,
+		CapacityUsed:            info.CapacityUsed,
+		TopLevelRequestsInQueue: info.TopLevelRequestsInQueue,
+	}
+	for _, sg := range info.SuperGroups {
+		usedSG := SuperGroup{
+			Name:            sg.Name,
+			State:           sg.State,
+			CapacityUsed:    sg.CapacityUsed,
+			RequestsInQueue: sg.RequestsInQueue,
+		}
+		for _, g := range sg.Groups {
+			usedSG.Groups = append(usedSG.Groups, Group{
+				Name:                g.Name,
+				ComponentName:       g.ComponentName,
+				AppRoot:             g.AppRoot,
+				AppType:             g.AppType,
+				Environment:         g.Environment,
+				Default:             g.Default,
+				GetWaitListSize:     g.GetWaitListSize,
+				ProcessesSpawning:   g.ProcessesSpawning,
+				DisableWaitListSize: g.DisableWaitListSize,
+				Restarting:          g.Restarting,
+				RestartsInitiated:   g.RestartsInitiated,
+				LifeStatus:          g.LifeStatus,
+				CapacityUsed:        g.CapacityUsed,
+				Options: Options{
+					AppGroupName:         g.Options.AppGroupName,
+					SpawnMethod:          g.Options.SpawnMethod,
+					StickySessions:       g.Options.StickySessions,
+					MaxPreloaderIdleTime: g.Options.MaxPreloaderIdleTime,
+					MaxRequestQueueSize:  g.Options.MaxRequestQueueSize,
+				},
+				Processes:         usedProcessFields(g.Processes),
+				DetachedProcesses: usedProcessFields(g.DetachedProcesses),
+			})
+		}
+		used.SuperGroups = append(used.SuperGroups, usedSG)
+	}
+	return used
+}
+
+func usedProcessFields(processes []Process) []Process {
+	var used []Process
+	for _, proc := range processes {
+		used = append(used, Process{
+			PID:                 proc.PID,
+			GUPID:               proc.GUPID,
+			StickySessionID:     proc.StickySessionID,
+			RealMemory:          proc.RealMemory,
+			RequestsProcessed:   proc.RequestsProcessed,
+			Sessions:            proc.Sessions,
+			Concurrency:         proc.Concurrency,
+			Busyness:            proc.Busyness,
+			LifeStatus:          proc.LifeStatus,
+			Enabled:             proc.Enabled,
+			CPU:                 proc.CPU,
+			SpawnerCreationTime: proc.SpawnerCreationTime,
+			SpawnStartTime:      proc.SpawnStartTime,
+			SpawnEndTime:        proc.SpawnEndTime,
+			LastUsed:            proc.LastUsed,
+		})
+	}
+	return used
+}
+
+// largeFixture returns the fixture with its processes repeated to n.
+func largeFixture(t testing.TB, n int) []byte {
+	fixture, err := os.ReadFile("testdata/passenger_xml_output.xml")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	s := string(fixture)
+	start := strings.Index(s, "<process>")
+	end := strings.Index(s, "</process>") + len("</process>")
+	last := strings.LastIndex(s, "</process>") + len("</process>")
+	process := s[start:end]
+
+	var b strings.Builder
+	b.WriteString(s[:start])
+	for i := 0; i < n; i++ {
+		b.WriteString(strings.Replace(process, "<pid>1402</pid>", fmt.Sprintf("<pid>%d</pid>", 10000+i), 1))
+		b.WriteString("\n          ")
+	}
+	b.WriteString(s[last:])
+	return []byte(b.String())
+}
+
+func TestParseStream(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"synthetic passenger 4":            mustReadFile(t, "testdata/synthetic_passenger4_xml_output.xml"),
+		"passenger 5":                      mustReadFile(t, "testdata/passenger_xml_output.xml"),
+		"synthetic passenger 6":            mustReadFile(t, "testdata/synthetic_passenger6_xml_output.xml"),
+		"synthetic passenger 6 enterprise": mustReadFile(t, "testdata/synthetic_passenger6_enterprise_xml_output.xml"),
+		"500 processes":                    largeFixture(t, 500),
+	} {
+		t.Run(name, func(t *testing.T) {
+			want, err := Parse(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			got, err := ParseStream(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("stream parse failed: %v", err)
+			}
+			if !reflect.DeepEqual(usedFields(want), got) {
+				t.Errorf("stream parsed fields differ from Parse")
+			}
+		})
+	}
+}
+
+func TestParseStream_Errors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"<info><supergroups><supergroup>",
+		"<info><passenger_version>6.0.23</max></info>",
+	} {
+		if _, err := ParseStream(strings.NewReader(data)); err == nil {
+			t.Errorf("expected error parsing %q, got none", data)
+		}
+	}
+}
+
+func mustReadFile(t testing.TB, path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	return data
+}
+
+func BenchmarkParse(b *testing.B) {
+	data := largeFixture(b, 500)
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := Parse(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseStream(b *testing.B) {
+	data := largeFixture(b, 500)
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := ParseStream(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -18,3 +18,9 @@ import "io"
 type MetricsReader interface {
 	Read() (io.ReadCloser, error)
 }
+
+// InstanceReader reads from any of several Passenger instances.
+type InstanceReader interface {
+	Instances() ([]string, error)
+	ReadInstance(name string) (io.ReadCloser, error)
+}
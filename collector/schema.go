@@ -0,0 +1,59 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"slices"
+	"strconv"
+)
+
+// Schema versions of pool.xml, as reported by the version attribute of
+// <info>.
+const (
+	// SchemaVersion2 is served by Passenger 4.
+	SchemaVersion2 = "2"
+	// SchemaVersion3 is served by Passenger 5 and 6.
+	SchemaVersion3 = "3"
+)
+
+var knownSchemaVersions = []string{SchemaVersion2, SchemaVersion3}
+
+// KnownSchema reports whether the field mapping of the pool.xml schema
+// version is known. Documents of unknown versions are parsed like the latest
+// known one.
+func KnownSchema(version string) bool {
+	return slices.Contains(knownSchemaVersions, version)
+}
+
+// deriveCounts fills in the app and process counts info lacks, e.g. the app
+// count of schema version 2, from its apps and processes.
+func deriveCounts(info *Info) {
+	if info.AppCount == "" {
+		info.AppCount = strconv.Itoa(len(info.SuperGroups))
+	}
+	if info.CurrentProcessCount == "" {
+		info.CurrentProcessCount = strconv.Itoa(processCount(info))
+	}
+}
+
+// processCount returns the number of processes of info.
+func processCount(info *Info) int {
+	processes := 0
+	for _, sg := range info.SuperGroups {
+		for _, group := range sg.Groups {
+			processes += len(group.Processes)
+		}
+	}
+	return processes
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"time"
+)
+
+// processProgress is what the collector remembers about the progress of a
+// process between scrapes.
+type processProgress struct {
+	processed, lastUsed string
+	// busySince is when the process was first seen busy without processing
+	// a request, zero if it is not.
+	busySince time.Time
+	stuck     bool
+}
+
+// observeStuck remembers the progress of the processes of info at now and
+// returns whether they are stuck by PID. A process is stuck when it has had
+// sessions without processing a request or being used for the stuck
+// threshold.
+func (c *Collector) observeStuck(info *Info, now time.Time) map[string]bool {
+	stuck := make(map[string]bool)
+	if c.stuckThreshold <= 0 {
+		return stuck
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seen := make(map[string]bool)
+	for _, sg := range info.SuperGroups {
+		for _, group := range sg.Groups {
+			for _, proc := range group.Processes {
+				seen[proc.PID] = true
+				progress, ok := c.progress[proc.PID]
+				if !ok {
+					progress = &processProgress{}
+					c.progress[proc.PID] = progress
+				}
+
+				busy := parseFloat(proc.Sessions) > 0
+				advanced := !ok || proc.RequestsProcessed != progress.processed || proc.LastUsed != progress.lastUsed
+				switch {
+				case !busy:
+					progress.busySince = time.Time{}
+				case advanced || progress.busySince.IsZero():
+					progress.busySince = now
+				}
+				progress.processed, progress.lastUsed = proc.RequestsProcessed, proc.LastUsed
+
+				wasStuck := progress.stuck
+				progress.stuck = !progress.busySince.IsZero() && now.Sub(progress.busySince) >= c.stuckThreshold
+				if progress.stuck && !wasStuck && c.logStuck {
+					c.logger.Warn("Process stuck", "app", sg.Name, "component", group.ComponentName, "pid", proc.PID,
+						"sessions", proc.Sessions, "busy_for", now.Sub(progress.busySince))
+				}
+				stuck[proc.PID] = progress.stuck
+			}
+		}
+	}
+	for pid := range c.progress {
+		if !seen[pid] {
+			delete(c.progress, pid)
+		}
+	}
+	return stuck
+}
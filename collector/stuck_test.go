@@ -0,0 +1,103 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promslog"
+)
+
+func TestObserveStuck(t *testing.T) {
+	var logs bytes.Buffer
+	c := New(&fakeReader{}, WithStuckDetection(time.Minute, true), WithLogger(promslog.New(&promslog.Config{Writer: &logs})))
+	now := time.Unix(1714989600, 0)
+	info := func(sessions, processed, lastUsed string) *Info {
+		return &Info{SuperGroups: []SuperGroup{{Name: "web", Groups: []Group{{
+			Name:      "web",
+			Processes: []Process{{PID: "1", Sessions: sessions, RequestsProcessed: processed, LastUsed: lastUsed}},
+		}}}}}
+	}
+
+	for i, tc := range []struct {
+		after time.Duration
+		info  *Info
+		want  bool
+	}{
+		{info: info("1", "10", "100"), want: false},
+		{after: 30 * time.Second, info: info("1", "10", "100"), want: false},
+		{after: 30 * time.Second, info: info("1", "10", "100"), want: true},
+		{after: 30 * time.Second, info: info("1", "10", "100"), want: true},
+		// Processing a request restarts the clock.
+		{after: 30 * time.Second, info: info("1", "11", "200"), want: false},
+		{after: 59 * time.Second, info: info("1", "11", "200"), want: false},
+		// So does having no session.
+		{after: 30 * time.Second, info: info("0", "11", "200"), want: false},
+		{after: 30 * time.Second, info: info("1", "11", "200"), want: false},
+		{after: time.Minute, info: info("1", "11", "200"), want: true},
+	} {
+		now = now.Add(tc.after)
+		if got := c.observeStuck(tc.info, now)["1"]; got != tc.want {
+			t.Errorf("scrape %d: expected stuck %v, got %v", i, tc.want, got)
+		}
+	}
+
+	if want, got := 2, strings.Count(logs.String(), "Process stuck"); want != got {
+		t.Errorf("expected %d warnings, got %d: %s", want, got, logs.String())
+	}
+	if !strings.Contains(logs.String(), "pid=1") {
+		t.Errorf("expected warning to name the PID, got %s", logs.String())
+	}
+
+	c.observeStuck(&Info{}, now)
+	if len(c.progress) != 0 {
+		t.Errorf("expected progress of processes gone to be dropped, got %v", c.progress)
+	}
+}
+
+func TestCollect_Stuck(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/synthetic_passenger6_xml_output.xml")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	t.Setenv("HOSTNAME", "local-machine")
+	reader := &fakeReader{ReaderFunc: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(fixture)), nil }}
+	c := New(reader, WithStuckDetection(time.Minute, false))
+	now := time.Unix(1714989600, 0)
+	c.now = func() time.Time { return now }
+
+	// The first web process keeps its session without processing requests.
+	testutil.CollectAndCount(c)
+	now = now.Add(2 * time.Minute)
+	want := `# HELP passenger_app_stuck_processes Number of stuck processes of an app.
+# TYPE passenger_app_stuck_processes gauge
+passenger_app_stuck_processes{app="/srv/app/api",environment="production",hostname="local-machine",name="/srv/app/api (production)"} 0
+passenger_app_stuck_processes{app="/srv/app/web",environment="production",hostname="local-machine",name="/srv/app/web (production)"} 1
+# HELP passenger_proc_stuck Whether a process has had sessions without processing a request for the stuck threshold.
+# TYPE passenger_proc_stuck gauge
+passenger_proc_stuck{app="/srv/app/api",component="/srv/app/api (production)",environment="production",hostname="local-machine",id="0",name="/srv/app/api (production)"} 0
+passenger_proc_stuck{app="/srv/app/web",component="/srv/app/web (production)",environment="production",hostname="local-machine",id="0",name="/srv/app/web (production)"} 1
+passenger_proc_stuck{app="/srv/app/web",component="/srv/app/web (production)",environment="production",hostname="local-machine",id="1",name="/srv/app/web (production)"} 0
+`
+	err = testutil.CollectAndCompare(c, strings.NewReader(want), "passenger_app_stuck_processes", "passenger_proc_stuck")
+	if err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
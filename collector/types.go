@@ -22,7 +22,10 @@
 
 package collector
 
+import "strconv"
+
 type Info struct {
+	SchemaVersion           string       `xml:"version,attr"`
 	CapacityUsed            string       `xml:"capacity_used"`
 	MaxProcessCount         string       `xml:"max"`
 	PassengerVersion        string       `xml:"passenger_version"`
@@ -33,11 +36,36 @@ type Info struct {
 }
 
 type SuperGroup struct {
-	RequestsInQueue string `xml:"get_wait_list_size"`
-	CapacityUsed    string `xml:"capacity_used"`
-	State           string `xml:"state"`
-	Group           Group  `xml:"group"`
-	Name            string `xml:"name"`
+	RequestsInQueue string  `xml:"get_wait_list_size"`
+	CapacityUsed    string  `xml:"capacity_used"`
+	State           string  `xml:"state"`
+	Groups          []Group `xml:"group"`
+	Name            string  `xml:"name"`
+}
+
+// DefaultGroup returns the group marked as default, falling back to the first
+// one, or nil if there are no groups.
+func (sg *SuperGroup) DefaultGroup() *Group {
+	for i := range sg.Groups {
+		if sg.Groups[i].Default == "true" {
+			return &sg.Groups[i]
+		}
+	}
+	if len(sg.Groups) > 0 {
+		return &sg.Groups[0]
+	}
+	return nil
+}
+
+// Queue returns the number of requests waiting in the queues of sg and its
+// groups.
+func (sg *SuperGroup) Queue() int {
+	size, _ := strconv.Atoi(sg.RequestsInQueue)
+	for _, group := range sg.Groups {
+		n, _ := strconv.Atoi(group.GetWaitListSize)
+		size += n
+	}
+	return size
 }
 
 type Group struct {
@@ -61,6 +89,12 @@ type Group struct {
 	ProcessesSpawning     string    `xml:"processes_being_spawned"`
 	Options               Options   `xml:"options"`
 	Processes             []Process `xml:"processes>process"`
+
+	// Reported by Passenger Enterprise, detached processes are the ones
+	// replaced during a rolling restart that are still finishing requests.
+	Restarting        string    `xml:"restarting"`
+	RestartsInitiated string    `xml:"restarts_initiated"`
+	DetachedProcesses []Process `xml:"detached_processes>process"`
 }
 
 type Process struct {
@@ -100,8 +134,10 @@ type Options struct {
 	StartCommand              string `xml:"start_command"`
 	USTRouterUsername         string `xml:"ust_router_username"`
 	MaxPreloaderIdleTime      string `xml:"max_preloader_idle_time"`
+	MaxRequestQueueSize       string `xml:"max_request_queue_size"`
 	BaseURI                   string `xml:"base_uri"`
 	SpawnMethod               string `xml:"spawn_method"`
+	StickySessions            string `xml:"sticky_sessions"`
 	AppType                   string `xml:"app_type"`
 	Environment               string `xml:"environment"`
 	Analytics                 string `xml:"analytics"`
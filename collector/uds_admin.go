@@ -0,0 +1,88 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// Restart methods of an app group.
+const (
+	RestartRolling  = "rolling"
+	RestartBlocking = "blocking"
+)
+
+// adminTimeout bounds write operations, which Passenger may take a while to
+// acknowledge.
+const adminTimeout = 30 * time.Second
+
+// RestartAppGroup restarts the named app group, e.g. "/srv/app (production)",
+// of the named Passenger instance, like passenger-config restart-app.
+func (r *UDSReader) RestartAppGroup(instance, group, method string) error {
+	var resp struct{}
+	return r.post(instance, "/pool/restart_app_group.json", map[string]string{
+		"name":           group,
+		"restart_method": method,
+	}, &resp)
+}
+
+// DetachProcess detaches the process with pid from the pool of the named
+// Passenger instance, like passenger-config detach-process. Passenger shuts
+// the process down once it has finished its requests.
+func (r *UDSReader) DetachProcess(instance string, pid int) error {
+	var resp struct {
+		Detached bool `json:"detached"`
+	}
+	if err := r.post(instance, "/pool/detach_process.json", map[string]int{"pid": pid}, &resp); err != nil {
+		return err
+	}
+	if !resp.Detached {
+		return fmt.Errorf("process %d was not detached", pid)
+	}
+	return nil
+}
+
+// post sends body as JSON to path of the core API of the named instance with
+// the full admin credentials, decoding the response into resp. It does not
+// take the reader lock, so reads go on while Passenger performs the write.
+func (r *UDSReader) post(name, path string, body, resp any) error {
+	if ok, _ := filepath.Match(instancePattern, name); !ok {
+		return fmt.Errorf("invalid Passenger instance name %q", name)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://unix"+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	response, err := r.do(filepath.Join(r.Path, name), req, FullAdminUsername, FullAdminPasswordFile, adminTimeout)
+	if err != nil {
+		return err
+	}
+	defer response.Close()
+	if err := json.NewDecoder(response).Decode(resp); err != nil {
+		return fmt.Errorf("decoding response to %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nex-health/passenger-exporter/collector"
+	"github.com/nex-health/passenger-exporter/passengertest"
+)
+
+func TestRestartAppGroup(t *testing.T) {
+	inst := passengertest.New(t)
+	inst.Handle("/pool/restart_app_group.json", passengertest.Response{Body: []byte(`{}`)})
+
+	err := collector.NewUDSReader(inst.Registry).RestartAppGroup(inst.Name, "/srv/app (production)", collector.RestartRolling)
+	if err != nil {
+		t.Fatalf("failed to restart app group: %s", err.Error())
+	}
+
+	var body map[string]string
+	if err := json.Unmarshal(inst.LastBody("/pool/restart_app_group.json"), &body); err != nil {
+		t.Fatalf("failed to decode request body: %s", err.Error())
+	}
+	want := map[string]string{"name": "/srv/app (production)", "restart_method": "rolling"}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("expected body %v, got %v", want, body)
+	}
+}
+
+func TestRestartAppGroup_DoesNotBlockReads(t *testing.T) {
+	inst := passengertest.New(t)
+	inst.Handle("/pool/restart_app_group.json", passengertest.Response{Body: []byte(`{}`), Delay: 2 * time.Second})
+	inst.SetPoolXML([]byte(`<info version="3"></info>`))
+	reader := collector.NewUDSReader(inst.Registry)
+
+	restarted := make(chan error, 1)
+	go func() {
+		restarted <- reader.RestartAppGroup(inst.Name, "/srv/app (production)", collector.RestartBlocking)
+	}()
+	for inst.Requests("/pool/restart_app_group.json") == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	start := time.Now()
+	data, err := reader.Read()
+	if err != nil {
+		t.Fatalf("failed to read pool.xml during a restart: %s", err.Error())
+	}
+	data.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected pool.xml to be read while the restart is pending, waited %s", elapsed)
+	}
+	if err := <-restarted; err != nil {
+		t.Errorf("failed to restart app group: %s", err.Error())
+	}
+}
+
+func TestDetachProcess(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		response passengertest.Response
+		password string
+		wantErr  string
+	}{
+		{
+			name:     "detached",
+			response: passengertest.Response{Body: []byte(`{"detached":true}`)},
+		},
+		{
+			name:     "not detached",
+			response: passengertest.Response{Body: []byte(`{"detached":false}`)},
+			wantErr:  "process 3101 was not detached",
+		},
+		{
+			name:     "stale password",
+			response: passengertest.Response{Body: []byte(`{"detached":true}`)},
+			password: "stale",
+			wantErr:  "unexpected status code 401",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			inst := passengertest.New(t)
+			inst.Handle("/pool/detach_process.json", tc.response)
+			if tc.password != "" {
+				inst.SetPassword(passengertest.FullAdminUsername, tc.password)
+			}
+
+			err := collector.NewUDSReader(inst.Registry).DetachProcess(inst.Name, 3101)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("failed to detach process: %s", err.Error())
+				}
+				if got := string(inst.LastBody("/pool/detach_process.json")); got != `{"pid":3101}` {
+					t.Errorf("expected body %s, got %s", `{"pid":3101}`, got)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("expected error to contain %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
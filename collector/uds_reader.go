@@ -29,6 +29,13 @@ const (
 	UDSPath                   = "agents.s/core_api"
 	ReadOnlyAdminUsername     = "ro_admin"
 	ReadOnlyAdminPasswordFile = "read_only_admin_password.txt"
+	FullAdminUsername         = "admin"
+	FullAdminPasswordFile     = "full_admin_password.txt"
+
+	instancePattern = "passenger.???????"
+
+	readTimeout       = 1 * time.Second
+	backtracesTimeout = 30 * time.Second
 )
 
 type UDSReader struct {
@@ -43,29 +50,84 @@ func NewUDSReader(path string) *UDSReader {
 	}
 }
 
+// Read reads pool.xml from the first Passenger instance in the registry.
 func (r *UDSReader) Read() (io.ReadCloser, error) {
 	r.Lock()
 	defer r.Unlock()
 
-	registry, err := filepath.Glob(filepath.Join(r.Path, "passenger.???????"))
+	instance, err := r.instanceDir()
 	if err != nil {
 		return nil, err
 	}
 
-	if len(registry) == 0 {
-		return nil, fmt.Errorf("failed to detect Passenger instance registry directory")
+	return r.get(instance, "/pool.xml", readTimeout)
+}
+
+// Backtraces reads the backtraces of the threads of all processes from the
+// first Passenger instance in the registry.
+//
+// Dumping the threads of every process of a busy Passenger takes a while, so
+// backtraces get a longer timeout than pool.xml and are read without holding
+// the reader lock, leaving reads of pool.xml unaffected.
+func (r *UDSReader) Backtraces() (io.ReadCloser, error) {
+	r.Lock()
+	instance, err := r.instanceDir()
+	r.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.get(instance, "/backtraces.txt", backtracesTimeout)
+}
+
+// Instances returns the names of all Passenger instances in the registry.
+func (r *UDSReader) Instances() ([]string, error) {
+	registry, err := filepath.Glob(filepath.Join(r.Path, instancePattern))
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]string, 0, len(registry))
+	for _, instance := range registry {
+		instances = append(instances, filepath.Base(instance))
+	}
+	return instances, nil
+}
+
+// ReadInstance reads pool.xml from the named Passenger instance.
+func (r *UDSReader) ReadInstance(name string) (io.ReadCloser, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if ok, _ := filepath.Match(instancePattern, name); !ok {
+		return nil, fmt.Errorf("invalid Passenger instance name %q", name)
 	}
 
-	uds := filepath.Join(registry[0], UDSPath)
-	passwordFile := filepath.Join(registry[0], ReadOnlyAdminPasswordFile)
+	return r.get(filepath.Join(r.Path, name), "/pool.xml", readTimeout)
+}
+
+// get requests path from the core API of instance with the read-only
+// credentials, within timeout.
+func (r *UDSReader) get(instance, path string, timeout time.Duration) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://unix"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return r.do(instance, req, ReadOnlyAdminUsername, ReadOnlyAdminPasswordFile, timeout)
+}
 
-	password, err := os.ReadFile(passwordFile)
+// do sends req to the core API of instance, authenticated as username with
+// the password in passwordFile.
+func (r *UDSReader) do(instance string, req *http.Request, username, passwordFile string, timeout time.Duration) (io.ReadCloser, error) {
+	uds := filepath.Join(instance, UDSPath)
+
+	password, err := os.ReadFile(filepath.Join(instance, passwordFile))
 	if err != nil {
 		return nil, err
 	}
 
 	client := http.Client{
-		Timeout: 1 * time.Second,
+		Timeout: timeout,
 		Transport: &http.Transport{
 			DisableKeepAlives: true,
 			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
@@ -73,16 +135,39 @@ func (r *UDSReader) Read() (io.ReadCloser, error) {
 			},
 		},
 	}
-	req, err := http.NewRequest(http.MethodGet, "http://unix/pool.xml", nil)
-	if err != nil {
-		return nil, err
-	}
 
-	req.SetBasicAuth(ReadOnlyAdminUsername, string(password))
+	req.SetBasicAuth(username, string(password))
 
 	response, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("unexpected status code %d reading %s", response.StatusCode, req.URL)
+	}
 	return response.Body, nil
 }
+
+// Instance returns the name of the Passenger instance that is read from, i.e.
+// the base name of its directory in the instance registry.
+func (r *UDSReader) Instance() (string, error) {
+	instance, err := r.instanceDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(instance), nil
+}
+
+func (r *UDSReader) instanceDir() (string, error) {
+	registry, err := filepath.Glob(filepath.Join(r.Path, instancePattern))
+	if err != nil {
+		return "", err
+	}
+
+	if len(registry) == 0 {
+		return "", fmt.Errorf("failed to detect Passenger instance registry directory")
+	}
+
+	return registry[0], nil
+}
@@ -11,16 +11,22 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package collector
+package collector_test
 
 import (
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/nex-health/passenger-exporter/collector"
+	"github.com/nex-health/passenger-exporter/passengertest"
 )
 
 func TestRead_Files(t *testing.T) {
@@ -28,6 +34,7 @@ func TestRead_Files(t *testing.T) {
 	if err != nil {
 		t.Errorf("failed to create temporary directory: %s", err.Error())
 	}
+	defer os.RemoveAll(tempWithPasswordFile)
 
 	instRegWithPasswordFile := filepath.Join(tempWithPasswordFile, "passenger.aBc0d2z")
 	err = os.Mkdir(instRegWithPasswordFile, 0755)
@@ -35,7 +42,7 @@ func TestRead_Files(t *testing.T) {
 		t.Errorf("failed to create instance registry directory: %s", err.Error())
 	}
 
-	err = os.WriteFile(filepath.Join(instRegWithPasswordFile, ReadOnlyAdminPasswordFile), []byte("fake"), 0644)
+	err = os.WriteFile(filepath.Join(instRegWithPasswordFile, collector.ReadOnlyAdminPasswordFile), []byte("fake"), 0644)
 	if err != nil {
 		t.Errorf("failed to create password file: %s", err.Error())
 	}
@@ -44,6 +51,7 @@ func TestRead_Files(t *testing.T) {
 	if err != nil {
 		t.Errorf("failed to create temporary directory: %s", err.Error())
 	}
+	defer os.RemoveAll(tempWithoutPasswordFile)
 
 	instRegWithoutPasswordFile := filepath.Join(tempWithoutPasswordFile, "passenger.zk9bVz7")
 	err = os.Mkdir(instRegWithoutPasswordFile, 0755)
@@ -63,13 +71,7 @@ func TestRead_Files(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		socketPath := filepath.Join(test.path, UDSPath)
-		closeFn, _ := socketListerner(socketPath, []byte{})
-		if closeFn != nil {
-			defer closeFn()
-		}
-
-		reader := NewUDSReader(test.path)
+		reader := collector.NewUDSReader(test.path)
 		_, err = reader.Read()
 
 		if err == nil {
@@ -82,68 +84,200 @@ func TestRead_Files(t *testing.T) {
 }
 
 func TestRead_Data(t *testing.T) {
-	temp, err := os.MkdirTemp(os.TempDir(), "")
+	fixture, _ := os.ReadFile("testdata/passenger_xml_output.xml")
+
+	inst := passengertest.New(t)
+	inst.SetPoolXML(fixture)
+
+	reader := collector.NewUDSReader(inst.Registry)
+	resp, err := reader.Read()
 	if err != nil {
-		t.Errorf("failed to create temporary directory: %s", err.Error())
+		t.Fatalf("failed to read data: %s", err.Error())
 	}
-	defer os.RemoveAll(temp)
-	fmt.Println(temp)
+	defer resp.Close()
 
-	instReg := filepath.Join(temp, "passenger.Lj9cMz7")
-	err = os.Mkdir(instReg, 0755)
+	data, err := io.ReadAll(resp)
 	if err != nil {
-		t.Errorf("failed to create instance registry directory: %s", err.Error())
+		t.Errorf("failed to read data: %s", err.Error())
+	}
+
+	if string(data) != string(fixture) {
+		t.Errorf("read data different from fixture")
+	}
+	if inst.Requests("/pool.xml") != 1 {
+		t.Errorf("expected 1 request for /pool.xml, got %d", inst.Requests("/pool.xml"))
 	}
+}
+
+func TestRead_Failures(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		setup   func(*passengertest.Instance)
+		wantErr string
+	}{
+		{
+			name:    "unscripted",
+			setup:   func(*passengertest.Instance) {},
+			wantErr: `unexpected status code 404 reading http://unix/pool.xml`,
+		},
+		{
+			name: "stale password file",
+			setup: func(inst *passengertest.Instance) {
+				inst.SetPoolXML([]byte("<info/>"))
+				inst.SetPassword(collector.ReadOnlyAdminUsername, "rotated")
+			},
+			wantErr: `unexpected status code 401 reading http://unix/pool.xml`,
+		},
+		{
+			name: "internal error",
+			setup: func(inst *passengertest.Instance) {
+				inst.Handle("/pool.xml", passengertest.Response{Status: http.StatusInternalServerError})
+			},
+			wantErr: `unexpected status code 500 reading http://unix/pool.xml`,
+		},
+		{
+			name: "slow response",
+			setup: func(inst *passengertest.Instance) {
+				inst.Handle("/pool.xml", passengertest.Response{Body: []byte("<info/>"), Delay: 2 * time.Second})
+			},
+			wantErr: `(Client.Timeout exceeded while awaiting headers)`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			inst := passengertest.New(t)
+			tc.setup(inst)
+
+			_, err := collector.NewUDSReader(inst.Registry).Read()
+			if err == nil {
+				t.Fatalf("expected error, got none")
+			}
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("expected error to contain %q, got %q", tc.wantErr, err.Error())
+			}
+		})
+	}
+}
 
-	err = os.WriteFile(filepath.Join(instReg, ReadOnlyAdminPasswordFile), []byte("fake"), 0644)
+func TestBacktraces(t *testing.T) {
+	inst := passengertest.New(t)
+	inst.Handle("/backtraces.txt", passengertest.Response{Body: []byte("Thread 1:\n")})
+
+	data, err := collector.NewUDSReader(inst.Registry).Backtraces()
 	if err != nil {
-		t.Errorf("failed to create password file: %s", err.Error())
+		t.Fatalf("failed to read backtraces: %s", err.Error())
 	}
+	defer data.Close()
 
-	err = os.Mkdir(filepath.Join(instReg, filepath.Dir(UDSPath)), 0755)
+	backtraces, err := io.ReadAll(data)
 	if err != nil {
-		t.Errorf("failed to create temporary directory: %s", err.Error())
+		t.Errorf("failed to read backtraces: %s", err.Error())
+	}
+	if string(backtraces) != "Thread 1:\n" {
+		t.Errorf("expected backtraces %q, got %q", "Thread 1:\n", backtraces)
 	}
+}
 
-	fixture, _ := os.ReadFile("testdata/passenger_xml_output.xml")
+func TestBacktraces_Slow(t *testing.T) {
+	// Slower than pool.xml may take, as when Passenger is saturated.
+	inst := passengertest.New(t)
+	inst.Handle("/backtraces.txt", passengertest.Response{Body: []byte("Thread 1:\n"), Delay: 1500 * time.Millisecond})
+	inst.Handle("/pool.xml", passengertest.Response{Body: []byte(`<info version="3"></info>`), Delay: 1500 * time.Millisecond})
+	reader := collector.NewUDSReader(inst.Registry)
 
-	socketPath := filepath.Join(instReg, UDSPath)
-	closeFn, err := socketListerner(socketPath, fixture)
+	data, err := reader.Backtraces()
 	if err != nil {
-		t.Fatalf("failed to start test server: %s", err.Error())
+		t.Fatalf("failed to read backtraces: %s", err.Error())
 	}
-	defer closeFn()
+	data.Close()
 
-	reader := NewUDSReader(temp)
-	resp, err := reader.Read()
+	if _, err := reader.Read(); err == nil {
+		t.Errorf("expected reading pool.xml to time out")
+	}
+}
+
+func TestRead_MalformedXML(t *testing.T) {
+	inst := passengertest.New(t)
+	inst.SetPoolXML([]byte(passengertest.MalformedXML))
+
+	data, err := collector.NewUDSReader(inst.Registry).Read()
 	if err != nil {
-		t.Errorf("failed to read data: %s", err.Error())
+		t.Fatalf("failed to read data: %s", err.Error())
 	}
-	defer resp.Close()
+	defer data.Close()
 
-	data, err := io.ReadAll(resp)
+	if _, err := collector.Parse(data); err == nil {
+		t.Errorf("expected parse error, got none")
+	}
+}
+
+func TestInstance(t *testing.T) {
+	temp, err := os.MkdirTemp(os.TempDir(), "")
 	if err != nil {
-		t.Errorf("failed to read data: %s", err.Error())
+		t.Errorf("failed to create temporary directory: %s", err.Error())
+	}
+	defer os.RemoveAll(temp)
+
+	reader := collector.NewUDSReader(temp)
+	if _, err := reader.Instance(); err == nil {
+		t.Errorf("expected error for empty instance registry, got none")
 	}
 
-	if string(data) != string(fixture) {
-		t.Errorf("read data different from fixture")
+	err = os.Mkdir(filepath.Join(temp, "passenger.Lj9cMz7"), 0755)
+	if err != nil {
+		t.Errorf("failed to create instance registry directory: %s", err.Error())
+	}
+
+	instance, err := reader.Instance()
+	if err != nil {
+		t.Errorf("failed to detect instance: %s", err.Error())
+	}
+	if instance != "passenger.Lj9cMz7" {
+		t.Errorf("expected instance %q, got %q", "passenger.Lj9cMz7", instance)
 	}
 }
 
-func socketListerner(path string, body []byte) (func() error, error) {
-	server := http.Server{
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-			w.Write(body)
-		}),
+func TestInstances(t *testing.T) {
+	first := passengertest.New(t)
+	first.SetPoolXML([]byte("<info><passenger_version>6.0.23</passenger_version></info>"))
+	second, err := passengertest.NewInstance(first.Registry)
+	if err != nil {
+		t.Fatalf("failed to start second instance: %s", err.Error())
+	}
+	defer second.Close()
+	second.SetPoolXML([]byte("<info><passenger_version>6.0.24</passenger_version></info>"))
+
+	if err := os.Mkdir(filepath.Join(first.Registry, "unrelated"), 0755); err != nil {
+		t.Errorf("failed to create directory: %s", err.Error())
 	}
 
-	unixListener, err := net.Listen("unix", path)
+	reader := collector.NewUDSReader(first.Registry)
+	instances, err := reader.Instances()
 	if err != nil {
-		return nil, err
+		t.Errorf("failed to list instances: %s", err.Error())
+	}
+	want := []string{first.Name, second.Name}
+	sort.Strings(want)
+	if !reflect.DeepEqual(want, instances) {
+		t.Errorf("expected instances %q, got %q", want, instances)
+	}
+
+	for inst, version := range map[*passengertest.Instance]string{first: "6.0.23", second: "6.0.24"} {
+		data, err := reader.ReadInstance(inst.Name)
+		if err != nil {
+			t.Fatalf("failed to read instance %s: %s", inst.Name, err.Error())
+		}
+		info, err := collector.Parse(data)
+		data.Close()
+		if err != nil {
+			t.Fatalf("failed to parse instance %s: %s", inst.Name, err.Error())
+		}
+		if info.PassengerVersion != version {
+			t.Errorf("expected version %q from %s, got %q", version, inst.Name, info.PassengerVersion)
+		}
+	}
+
+	_, err = reader.ReadInstance("../" + first.Name)
+	if want := fmt.Sprintf(`invalid Passenger instance name "../%s"`, first.Name); err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
 	}
-	go func() {
-		server.Serve(unixListener)
-	}()
-	return server.Close, nil
 }
@@ -0,0 +1,214 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package events derives a stream of events from the changes between
+// consecutive pools read by the collector.
+package events
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/nex-health/passenger-exporter/collector"
+)
+
+// Types of events.
+const (
+	AppAdded               = "app_added"
+	AppRemoved             = "app_removed"
+	ProcessSpawned         = "process_spawned"
+	ProcessExited          = "process_exited"
+	GroupLifeStatusChanged = "group_life_status_changed"
+	QueueExceeded          = "queue_exceeded"
+)
+
+// Event is a change between two pools. Like the labels of the metrics, Name
+// is the name of the app in Passenger and App and Environment the ones of the
+// AppNamer.
+type Event struct {
+	Time        time.Time `json:"time"`
+	Type        string    `json:"type"`
+	Name        string    `json:"name"`
+	App         string    `json:"app"`
+	Environment string    `json:"environment,omitempty"`
+	// Group is the app group of process and life status events.
+	Group string `json:"group,omitempty"`
+	PID   string `json:"pid,omitempty"`
+	// From and To are the life statuses of life status events.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	// Queue is the number of requests waiting in the queue of the app of
+	// queue events.
+	Queue int `json:"queue,omitempty"`
+}
+
+// Log diffs every pool it observes against the previous one, logs the events
+// found and keeps the latest ones in a ring buffer. The first pool observed
+// only sets the baseline.
+type Log struct {
+	logger     *slog.Logger
+	queueAbove int
+	namer      collector.AppNamer
+
+	mu     sync.Mutex
+	prev   *collector.Info
+	events []Event
+	// next is the index the next event is stored at once events is full.
+	next int
+}
+
+// New returns a log keeping the latest size events and reporting queues of
+// more than queueAbove requests, 0 disabling queue events. Apps are named by
+// namer, like in the labels of the metrics.
+func New(size, queueAbove int, namer collector.AppNamer, logger *slog.Logger) *Log {
+	return &Log{
+		logger:     logger,
+		queueAbove: queueAbove,
+		namer:      namer,
+		events:     make([]Event, 0, size),
+	}
+}
+
+// Observe records the events between the previous pool and info.
+func (l *Log) Observe(at time.Time, info *collector.Info) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.prev != nil {
+		for _, event := range diff(l.prev, info, l.queueAbove, &l.namer) {
+			event.Time = at
+			l.record(event)
+		}
+	}
+	l.prev = info
+}
+
+// Events returns the events kept, oldest first.
+func (l *Log) Events() []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	events := make([]Event, 0, len(l.events))
+	events = append(events, l.events[l.next:]...)
+	return append(events, l.events[:l.next]...)
+}
+
+func (l *Log) record(event Event) {
+	attrs := []any{"type", event.Type, "name", event.Name, "app", event.App}
+	for _, attr := range []struct{ key, value string }{
+		{"environment", event.Environment}, {"group", event.Group}, {"pid", event.PID}, {"from", event.From}, {"to", event.To},
+	} {
+		if attr.value != "" {
+			attrs = append(attrs, attr.key, attr.value)
+		}
+	}
+	if event.Queue != 0 {
+		attrs = append(attrs, "queue", event.Queue)
+	}
+	l.logger.Info("Pool event", attrs...)
+
+	if cap(l.events) == 0 {
+		return
+	}
+	if len(l.events) < cap(l.events) {
+		l.events = append(l.events, event)
+		return
+	}
+	l.events[l.next] = event
+	l.next = (l.next + 1) % len(l.events)
+}
+
+// diff returns the events between prev and curr, in the order of the apps
+// and processes of curr followed by the ones removed.
+func diff(prev, curr *collector.Info, queueAbove int, namer *collector.AppNamer) []Event {
+	var events []Event
+	prevApps := make(map[string]*collector.SuperGroup, len(prev.SuperGroups))
+	for i := range prev.SuperGroups {
+		prevApps[prev.SuperGroups[i].Name] = &prev.SuperGroups[i]
+	}
+
+	currApps := make(map[string]bool, len(curr.SuperGroups))
+	for i := range curr.SuperGroups {
+		sg := &curr.SuperGroups[i]
+		currApps[sg.Name] = true
+		app := appEvent(namer, sg)
+		old, ok := prevApps[sg.Name]
+		if !ok {
+			old = &collector.SuperGroup{}
+			events = append(events, app.with(Event{Type: AppAdded}))
+		}
+		events = append(events, diffApp(old, sg, app)...)
+
+		if size := sg.Queue(); queueAbove > 0 && size > queueAbove && old.Queue() <= queueAbove {
+			events = append(events, app.with(Event{Type: QueueExceeded, Queue: size}))
+		}
+	}
+	for i := range prev.SuperGroups {
+		sg := &prev.SuperGroups[i]
+		if currApps[sg.Name] {
+			continue
+		}
+		app := appEvent(namer, sg)
+		events = append(events, diffApp(sg, &collector.SuperGroup{}, app)...)
+		events = append(events, app.with(Event{Type: AppRemoved}))
+	}
+	return events
+}
+
+// appEvent returns the fields of the events of sg naming its app.
+func appEvent(namer *collector.AppNamer, sg *collector.SuperGroup) Event {
+	app, environment := namer.Name(sg)
+	return Event{Name: sg.Name, App: app, Environment: environment}
+}
+
+// with returns event with the app of e.
+func (e Event) with(event Event) Event {
+	event.Name, event.App, event.Environment = e.Name, e.App, e.Environment
+	return event
+}
+
+// diffApp returns the process and life status events between the groups of
+// prev and curr, of the app of app.
+func diffApp(prev, curr *collector.SuperGroup, app Event) []Event {
+	var events []Event
+	prevGroups := make(map[string]*collector.Group, len(prev.Groups))
+	prevPIDs := make(map[string]bool)
+	for i := range prev.Groups {
+		prevGroups[prev.Groups[i].Name] = &prev.Groups[i]
+		for _, proc := range prev.Groups[i].Processes {
+			prevPIDs[proc.PID] = true
+		}
+	}
+
+	currPIDs := make(map[string]bool)
+	for _, group := range curr.Groups {
+		if old, ok := prevGroups[group.Name]; ok && old.LifeStatus != group.LifeStatus {
+			events = append(events, app.with(Event{Type: GroupLifeStatusChanged, Group: group.Name, From: old.LifeStatus, To: group.LifeStatus}))
+		}
+		for _, proc := range group.Processes {
+			currPIDs[proc.PID] = true
+			if !prevPIDs[proc.PID] {
+				events = append(events, app.with(Event{Type: ProcessSpawned, Group: group.Name, PID: proc.PID}))
+			}
+		}
+	}
+	for _, group := range prev.Groups {
+		for _, proc := range group.Processes {
+			if !currPIDs[proc.PID] {
+				events = append(events, app.with(Event{Type: ProcessExited, Group: group.Name, PID: proc.PID}))
+			}
+		}
+	}
+	return events
+}
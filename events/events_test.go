@@ -0,0 +1,138 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nex-health/passenger-exporter/collector"
+	"github.com/nex-health/passenger-exporter/passengertest"
+	"github.com/prometheus/common/promslog"
+)
+
+func TestDiff(t *testing.T) {
+	app0 := Event{Name: "/srv/app/app0 (production)", App: "/srv/app/app0", Environment: "production"}
+	app1 := Event{Name: "/srv/app/app1 (production)", App: "/srv/app/app1", Environment: "production"}
+
+	for _, tc := range []struct {
+		name       string
+		spec       passengertest.Spec
+		prev, curr func(*collector.Info)
+		want       []Event
+	}{
+		{
+			name: "unchanged",
+			spec: passengertest.Spec{ProcessesPerApp: 2},
+		},
+		{
+			name: "processes replaced",
+			spec: passengertest.Spec{ProcessesPerApp: 2},
+			curr: func(info *collector.Info) { info.SuperGroups[0].DefaultGroup().Processes[0].PID = "1002" },
+			want: []Event{
+				app0.with(Event{Type: ProcessSpawned, Group: app0.Name, PID: "1002"}),
+				app0.with(Event{Type: ProcessExited, Group: app0.Name, PID: "1000"}),
+			},
+		},
+		{
+			name: "apps added and removed",
+			spec: passengertest.Spec{Apps: 2, ProcessesPerApp: 1},
+			prev: func(info *collector.Info) { info.SuperGroups = info.SuperGroups[:1] },
+			curr: func(info *collector.Info) { info.SuperGroups = info.SuperGroups[1:] },
+			want: []Event{
+				app1.with(Event{Type: AppAdded}),
+				app1.with(Event{Type: ProcessSpawned, Group: app1.Name, PID: "1001"}),
+				app0.with(Event{Type: ProcessExited, Group: app0.Name, PID: "1000"}),
+				app0.with(Event{Type: AppRemoved}),
+			},
+		},
+		{
+			name: "life status changed",
+			spec: passengertest.Spec{ProcessesPerApp: 1},
+			curr: func(info *collector.Info) { info.SuperGroups[0].DefaultGroup().LifeStatus = "SHUTTING_DOWN" },
+			want: []Event{
+				app0.with(Event{Type: GroupLifeStatusChanged, Group: app0.Name, From: "ALIVE", To: "SHUTTING_DOWN"}),
+			},
+		},
+		{
+			name: "queue exceeded",
+			spec: passengertest.Spec{Apps: 2, ProcessesPerApp: 1, AppQueue: 10},
+			prev: func(info *collector.Info) { info.SuperGroups[1].RequestsInQueue = "11" },
+			curr: func(info *collector.Info) {
+				info.SuperGroups[0].RequestsInQueue = "11"
+				info.SuperGroups[1].RequestsInQueue = "12"
+			},
+			want: []Event{
+				app0.with(Event{Type: QueueExceeded, Queue: 11}),
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prev, curr := passengertest.Generate(tc.spec), passengertest.Generate(tc.spec)
+			if tc.prev != nil {
+				tc.prev(prev)
+			}
+			if tc.curr != nil {
+				tc.curr(curr)
+			}
+			if got := diff(prev, curr, 10, &collector.AppNamer{}); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected events %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLog(t *testing.T) {
+	var logs bytes.Buffer
+	format := promslog.NewFormat()
+	format.Set("json")
+	log := New(2, 0, collector.AppNamer{}, promslog.New(&promslog.Config{Format: format, Writer: &logs}))
+	start := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	// The first pool is the baseline.
+	log.Observe(start, passengertest.Generate(passengertest.Spec{ProcessesPerApp: 1}))
+	if got := log.Events(); len(got) != 0 {
+		t.Errorf("expected no events for the baseline, got %+v", got)
+	}
+
+	for processes := 2; processes <= 4; processes++ {
+		log.Observe(start.Add(time.Duration(processes-1)*time.Minute), passengertest.Generate(passengertest.Spec{ProcessesPerApp: processes}))
+	}
+	app := "/srv/app/app0 (production)"
+	want := []Event{
+		{Time: start.Add(2 * time.Minute), Type: ProcessSpawned, Name: app, App: "/srv/app/app0", Environment: "production", Group: app, PID: "1002"},
+		{Time: start.Add(3 * time.Minute), Type: ProcessSpawned, Name: app, App: "/srv/app/app0", Environment: "production", Group: app, PID: "1003"},
+	}
+	if got := log.Events(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the latest events %+v, got %+v", want, got)
+	}
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 events logged, got %d: %s", len(lines), logs.String())
+	}
+	var logged map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &logged); err != nil {
+		t.Fatalf("expected events to be logged as JSON: %v", err)
+	}
+	// Apps are named like in the labels of the metrics.
+	if logged["type"] != ProcessSpawned || logged["pid"] != "1001" || logged["name"] != app ||
+		logged["app"] != "/srv/app/app0" || logged["environment"] != "production" {
+		t.Errorf("unexpected event logged: %s", lines[0])
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nex-health/passenger-exporter/collector"
+)
+
+// AdminClient performs write operations on Passenger instances.
+type AdminClient interface {
+	collector.InstanceReader
+	RestartAppGroup(instance, group, method string) error
+	DetachProcess(instance string, pid int) error
+}
+
+type AdminConfig struct {
+	// Token is the bearer token requests must be authenticated with.
+	Token string
+	// DryRun validates and logs actions without performing them.
+	DryRun bool
+}
+
+type adminRequest struct {
+	App    string `json:"app,omitempty"`
+	Method string `json:"method,omitempty"`
+	PID    int    `json:"pid,omitempty"`
+}
+
+type adminResult struct {
+	Action   string `json:"action"`
+	Instance string `json:"instance"`
+	App      string `json:"app,omitempty"`
+	Method   string `json:"method,omitempty"`
+	PID      int    `json:"pid,omitempty"`
+	DryRun   bool   `json:"dry_run"`
+}
+
+// Admin proxies write operations to the Passenger instances found by client,
+// authenticated with the token of config:
+//
+//	POST /api/v1/admin/instances/{name}/restart_app    {"app": NAME, "method": "rolling"}
+//	POST /api/v1/admin/instances/{name}/detach_process {"pid": PID}
+//
+// The app or process must be in the pool of the instance. Actions are dry
+// runs when config says so or the dry_run query parameter is true. Every
+// request is logged to logger for auditing.
+func Admin(client AdminClient, config AdminConfig, logger *slog.Logger) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/admin/instances/{name}/restart_app", func(w http.ResponseWriter, r *http.Request) {
+		result, info, req, ok := prepareAdmin(w, r, client, config, logger, "restart_app")
+		if !ok {
+			return
+		}
+		result.App, result.Method = req.App, req.Method
+		if result.Method == "" {
+			result.Method = collector.RestartRolling
+		}
+		if result.Method != collector.RestartRolling && result.Method != collector.RestartBlocking {
+			rejectAdmin(w, r, logger, result, http.StatusBadRequest, "method must be one of rolling and blocking")
+			return
+		}
+		if !slices.ContainsFunc(info.SuperGroups, func(sg collector.SuperGroup) bool { return sg.Name == req.App }) {
+			rejectAdmin(w, r, logger, result, http.StatusNotFound, "no app "+strconv.Quote(req.App))
+			return
+		}
+
+		performAdmin(w, r, logger, result, func() error {
+			return client.RestartAppGroup(result.Instance, result.App, result.Method)
+		})
+	})
+	mux.HandleFunc("POST /api/v1/admin/instances/{name}/detach_process", func(w http.ResponseWriter, r *http.Request) {
+		result, info, req, ok := prepareAdmin(w, r, client, config, logger, "detach_process")
+		if !ok {
+			return
+		}
+		result.PID = req.PID
+		app, found := findProcess(info, req.PID)
+		if !found {
+			rejectAdmin(w, r, logger, result, http.StatusNotFound, "no process "+strconv.Itoa(req.PID))
+			return
+		}
+		result.App = app
+
+		performAdmin(w, r, logger, result, func() error {
+			return client.DetachProcess(result.Instance, result.PID)
+		})
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(config.Token)) != 1 {
+			logger.Warn("Admin request rejected", "path", r.URL.Path, "remote", r.RemoteAddr, "reason", "invalid token")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="passenger_exporter"`)
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		if _, pattern := mux.Handler(r); pattern == "" {
+			logger.Warn("Admin request rejected", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr, "reason", "unknown action")
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// prepareAdmin decodes the request and reads the pool of the instance the
+// action is requested on, rejecting the request if either fails.
+func prepareAdmin(w http.ResponseWriter, r *http.Request, client AdminClient, config AdminConfig, logger *slog.Logger, action string) (adminResult, *collector.Info, adminRequest, bool) {
+	result := adminResult{
+		Action:   action,
+		Instance: r.PathValue("name"),
+		DryRun:   config.DryRun || r.URL.Query().Get("dry_run") == "true",
+	}
+	var req adminRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		rejectAdmin(w, r, logger, result, http.StatusBadRequest, "invalid request: "+err.Error())
+		return result, nil, req, false
+	}
+	names, err := client.Instances()
+	if err != nil {
+		rejectAdmin(w, r, logger, result, http.StatusServiceUnavailable, "failed to discover Passenger instances: "+err.Error())
+		return result, nil, req, false
+	}
+	if !slices.Contains(names, result.Instance) {
+		rejectAdmin(w, r, logger, result, http.StatusNotFound, "no Passenger instance "+strconv.Quote(result.Instance))
+		return result, nil, req, false
+	}
+	info, err := readInstance(client, result.Instance)
+	if err != nil {
+		rejectAdmin(w, r, logger, result, http.StatusBadGateway, "failed to read pool.xml: "+err.Error())
+		return result, nil, req, false
+	}
+	return result, info, req, true
+}
+
+// rejectAdmin logs and responds with why the action of result was not
+// performed.
+func rejectAdmin(w http.ResponseWriter, r *http.Request, logger *slog.Logger, result adminResult, status int, reason string) {
+	logger.Warn("Admin request rejected", append(adminAttrs(r, result), "reason", reason)...)
+	writeError(w, status, reason)
+}
+
+// adminAttrs returns the log attributes of the action of result requested by
+// r.
+func adminAttrs(r *http.Request, result adminResult) []any {
+	attrs := []any{"action", result.Action, "instance", result.Instance}
+	if result.App != "" {
+		attrs = append(attrs, "app", result.App)
+	}
+	if result.Method != "" {
+		attrs = append(attrs, "method", result.Method)
+	}
+	if result.PID != 0 {
+		attrs = append(attrs, "pid", result.PID)
+	}
+	return append(attrs, "remote", r.RemoteAddr, "dry_run", result.DryRun)
+}
+
+// performAdmin runs action unless result is a dry run, logging the outcome.
+func performAdmin(w http.ResponseWriter, r *http.Request, logger *slog.Logger, result adminResult, action func() error) {
+	attrs := adminAttrs(r, result)
+	if !result.DryRun {
+		if err := action(); err != nil {
+			logger.Error("Admin action failed", append(attrs, "err", err)...)
+			writeError(w, http.StatusBadGateway, result.Action+" failed: "+err.Error())
+			return
+		}
+	}
+	logger.Info("Admin action", attrs...)
+	writeJSON(w, result)
+}
+
+// findProcess returns the app of the process with pid in info.
+func findProcess(info *collector.Info, pid int) (string, bool) {
+	for _, sg := range info.SuperGroups {
+		for _, group := range sg.Groups {
+			for _, proc := range group.Processes {
+				if atoi(proc.PID) == pid {
+					return sg.Name, true
+				}
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/promslog"
+)
+
+// fakeAdminClient records the actions performed through it.
+type fakeAdminClient struct {
+	*fakeInstanceReader
+	actions []string
+	err     error
+}
+
+func (c *fakeAdminClient) RestartAppGroup(instance, group, method string) error {
+	c.actions = append(c.actions, fmt.Sprintf("restart %s %s %s", instance, group, method))
+	return c.err
+}
+
+func (c *fakeAdminClient) DetachProcess(instance string, pid int) error {
+	c.actions = append(c.actions, fmt.Sprintf("detach %s %d", instance, pid))
+	return c.err
+}
+
+func TestAdmin(t *testing.T) {
+	fixture, err := os.ReadFile("../collector/testdata/synthetic_passenger6_xml_output.xml")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		path        string
+		body        string
+		token       string
+		dryRun      bool
+		clientErr   error
+		wantStatus  int
+		wantActions []string
+		wantLog     string
+	}{
+		{
+			name:        "restart",
+			path:        "/api/v1/admin/instances/passenger.AbCdEfG/restart_app",
+			body:        `{"app": "/srv/app/web (production)"}`,
+			wantStatus:  http.StatusOK,
+			wantActions: []string{"restart passenger.AbCdEfG /srv/app/web (production) rolling"},
+			wantLog:     `msg="Admin action" action=restart_app instance=passenger.AbCdEfG app="/srv/app/web (production)" method=rolling`,
+		},
+		{
+			name:        "blocking restart",
+			path:        "/api/v1/admin/instances/passenger.AbCdEfG/restart_app",
+			body:        `{"app": "/srv/app/web (production)", "method": "blocking"}`,
+			wantStatus:  http.StatusOK,
+			wantActions: []string{"restart passenger.AbCdEfG /srv/app/web (production) blocking"},
+		},
+		{
+			name:       "unknown restart method",
+			path:       "/api/v1/admin/instances/passenger.AbCdEfG/restart_app",
+			body:       `{"app": "/srv/app/web (production)", "method": "now"}`,
+			wantStatus: http.StatusBadRequest,
+			wantLog:    `msg="Admin request rejected"`,
+		},
+		{
+			name:       "unknown app",
+			path:       "/api/v1/admin/instances/passenger.AbCdEfG/restart_app",
+			body:       `{"app": "/srv/app/admin (production)"}`,
+			wantStatus: http.StatusNotFound,
+			wantLog:    `msg="Admin request rejected"`,
+		},
+		{
+			name:        "detach",
+			path:        "/api/v1/admin/instances/passenger.AbCdEfG/detach_process",
+			body:        `{"pid": 3201}`,
+			wantStatus:  http.StatusOK,
+			wantActions: []string{"detach passenger.AbCdEfG 3201"},
+			wantLog:     `app="/srv/app/api (production)" pid=3201`,
+		},
+		{
+			name:       "unknown process",
+			path:       "/api/v1/admin/instances/passenger.AbCdEfG/detach_process",
+			body:       `{"pid": 1}`,
+			wantStatus: http.StatusNotFound,
+			wantLog:    `msg="Admin request rejected"`,
+		},
+		{
+			name:       "invalid body",
+			path:       "/api/v1/admin/instances/passenger.AbCdEfG/detach_process",
+			body:       `{"pid": "3201"`,
+			wantStatus: http.StatusBadRequest,
+			wantLog:    `msg="Admin request rejected" action=detach_process instance=passenger.AbCdEfG`,
+		},
+		{
+			name:       "unknown instance",
+			path:       "/api/v1/admin/instances/passenger.XXXXXXX/detach_process",
+			body:       `{"pid": 3201}`,
+			wantStatus: http.StatusNotFound,
+			wantLog:    `msg="Admin request rejected"`,
+		},
+		{
+			name:       "dry run query",
+			path:       "/api/v1/admin/instances/passenger.AbCdEfG/detach_process?dry_run=true",
+			body:       `{"pid": 3201}`,
+			wantStatus: http.StatusOK,
+			wantLog:    "dry_run=true",
+		},
+		{
+			name:       "dry run config",
+			path:       "/api/v1/admin/instances/passenger.AbCdEfG/restart_app",
+			body:       `{"app": "/srv/app/web (production)"}`,
+			dryRun:     true,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "failure",
+			path:        "/api/v1/admin/instances/passenger.AbCdEfG/detach_process",
+			body:        `{"pid": 3201}`,
+			clientErr:   errors.New("process 3201 was not detached"),
+			wantStatus:  http.StatusBadGateway,
+			wantActions: []string{"detach passenger.AbCdEfG 3201"},
+			wantLog:     `msg="Admin action failed"`,
+		},
+		{
+			name:       "invalid token",
+			path:       "/api/v1/admin/instances/passenger.AbCdEfG/detach_process",
+			body:       `{"pid": 3201}`,
+			token:      "guess",
+			wantStatus: http.StatusUnauthorized,
+			wantLog:    `msg="Admin request rejected"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeAdminClient{
+				fakeInstanceReader: &fakeInstanceReader{
+					names:     []string{"passenger.AbCdEfG"},
+					instances: map[string][]byte{"passenger.AbCdEfG": fixture},
+				},
+				err: tc.clientErr,
+			}
+			var logs bytes.Buffer
+			logger := promslog.New(&promslog.Config{Writer: &logs})
+			h := Admin(client, AdminConfig{Token: "secret", DryRun: tc.dryRun}, logger)
+
+			token := tc.token
+			if token == "" {
+				token = "secret"
+			}
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if !slices.Equal(client.actions, tc.wantActions) {
+				t.Errorf("expected actions %q, got %q", tc.wantActions, client.actions)
+			}
+			if !strings.Contains(logs.String(), tc.wantLog) {
+				t.Errorf("expected log to contain %q, got %s", tc.wantLog, logs.String())
+			}
+			if rec.Code == http.StatusOK {
+				var result adminResult
+				if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+					t.Fatalf("failed to decode result: %v", err)
+				}
+				if wantDryRun := len(tc.wantActions) == 0; result.DryRun != wantDryRun {
+					t.Errorf("expected dry run %t, got %+v", wantDryRun, result)
+				}
+			}
+		})
+	}
+}
+
+func TestAdmin_MethodNotAllowed(t *testing.T) {
+	var logs bytes.Buffer
+	h := Admin(&fakeAdminClient{fakeInstanceReader: &fakeInstanceReader{}}, AdminConfig{Token: "secret"}, promslog.New(&promslog.Config{Writer: &logs}))
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/instances/passenger.AbCdEfG/restart_app", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+	if want := `msg="Admin request rejected" method=GET`; !strings.Contains(logs.String(), want) {
+		t.Errorf("expected log to contain %q, got %s", want, logs.String())
+	}
+}
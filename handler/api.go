@@ -0,0 +1,270 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nex-health/passenger-exporter/collector"
+)
+
+// The API models pool.xml with stable field names and numeric types, leaving
+// out secrets and fields only Passenger itself has a use for. Like the labels
+// of the metrics, name is the name of the app in Passenger, which the admin
+// actions take, and app and environment are the ones of the AppNamer.
+
+type apiInstance struct {
+	Name string `json:"name"`
+	// Error is why the pool of the instance could not be read, the other
+	// fields being empty.
+	Error            string    `json:"error,omitempty"`
+	ReadAt           time.Time `json:"read_at"`
+	PassengerVersion string    `json:"passenger_version,omitempty"`
+	AppCount         int       `json:"app_count"`
+	ProcessCount     int       `json:"process_count"`
+	MaxProcessCount  int       `json:"max_process_count"`
+	CapacityUsed     int       `json:"capacity_used"`
+	RequestsInQueue  int       `json:"requests_in_queue"`
+}
+
+type apiApp struct {
+	Name            string     `json:"name"`
+	App             string     `json:"app"`
+	Environment     string     `json:"environment"`
+	State           string     `json:"state"`
+	CapacityUsed    int        `json:"capacity_used"`
+	RequestsInQueue int        `json:"requests_in_queue"`
+	ProcessCount    int        `json:"process_count"`
+	Groups          []apiGroup `json:"groups"`
+}
+
+type apiGroup struct {
+	Name              string `json:"name"`
+	Component         string `json:"component"`
+	Default           bool   `json:"default"`
+	AppRoot           string `json:"app_root"`
+	AppType           string `json:"app_type"`
+	Environment       string `json:"environment"`
+	LifeStatus        string `json:"life_status"`
+	CapacityUsed      int    `json:"capacity_used"`
+	RequestsInQueue   int    `json:"requests_in_queue"`
+	ProcessCount      int    `json:"process_count"`
+	ProcessesSpawning int    `json:"processes_spawning"`
+}
+
+type apiProcess struct {
+	Name              string     `json:"name"`
+	App               string     `json:"app"`
+	Environment       string     `json:"environment"`
+	Group             string     `json:"group"`
+	PID               int        `json:"pid"`
+	GUPID             string     `json:"gupid"`
+	LifeStatus        string     `json:"life_status"`
+	Enabled           string     `json:"enabled"`
+	Sessions          int        `json:"sessions"`
+	Concurrency       int        `json:"concurrency"`
+	Busyness          int        `json:"busyness"`
+	RequestsProcessed int        `json:"requests_processed"`
+	CPU               int        `json:"cpu"`
+	MemoryBytes       int64      `json:"memory_bytes"`
+	StartedAt         *time.Time `json:"started_at,omitempty"`
+	LastUsed          *time.Time `json:"last_used,omitempty"`
+}
+
+// PoolSource gives the pool the metrics are exported from, like the
+// collector.
+type PoolSource interface {
+	Pool() (*collector.Info, time.Time, error)
+}
+
+// API serves the pool the metrics are exported from as JSON:
+//
+//	GET /api/v1/instances
+//	GET /api/v1/instances/{name}
+//	GET /api/v1/instances/{name}/apps
+//	GET /api/v1/instances/{name}/processes[?name=NAME]
+//
+// The pool is the one of the Passenger instance named by instance. Apps and
+// processes carry the name of their app in Passenger, which the name query
+// parameter filters on, and the app and environment named by namer, like the
+// labels of the metrics.
+func API(pools PoolSource, instance func() (string, error), namer collector.AppNamer) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/instances", func(w http.ResponseWriter, r *http.Request) {
+		name, err := instance()
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, "failed to discover Passenger instances: "+err.Error())
+			return
+		}
+		info, readAt, err := pools.Pool()
+		writeJSON(w, []apiInstance{newAPIInstance(name, info, readAt, err)})
+	})
+	mux.HandleFunc("GET /api/v1/instances/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if info, readAt, ok := lookupPool(w, pools, instance, name); ok {
+			writeJSON(w, newAPIInstance(name, info, readAt, nil))
+		}
+	})
+	mux.HandleFunc("GET /api/v1/instances/{name}/apps", func(w http.ResponseWriter, r *http.Request) {
+		info, _, ok := lookupPool(w, pools, instance, r.PathValue("name"))
+		if !ok {
+			return
+		}
+		apps := make([]apiApp, 0, len(info.SuperGroups))
+		for i := range info.SuperGroups {
+			apps = append(apps, newAPIApp(&info.SuperGroups[i], &namer))
+		}
+		writeJSON(w, apps)
+	})
+	mux.HandleFunc("GET /api/v1/instances/{name}/processes", func(w http.ResponseWriter, r *http.Request) {
+		info, _, ok := lookupPool(w, pools, instance, r.PathValue("name"))
+		if !ok {
+			return
+		}
+		name := r.URL.Query().Get("name")
+		processes := []apiProcess{}
+		for _, sg := range info.SuperGroups {
+			if name != "" && sg.Name != name {
+				continue
+			}
+			app, environment := namer.Name(&sg)
+			for _, group := range sg.Groups {
+				for _, proc := range group.Processes {
+					process := newAPIProcess(sg.Name, group.Name, &proc)
+					process.App, process.Environment = app, environment
+					processes = append(processes, process)
+				}
+			}
+		}
+		writeJSON(w, processes)
+	})
+	return mux
+}
+
+// lookupPool returns the pool of the named instance, writing an error
+// response if it is not the one the pool is read from or the pool could not
+// be read.
+func lookupPool(w http.ResponseWriter, pools PoolSource, instance func() (string, error), name string) (*collector.Info, time.Time, bool) {
+	current, err := instance()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "failed to discover Passenger instances: "+err.Error())
+		return nil, time.Time{}, false
+	}
+	if name != current {
+		writeError(w, http.StatusNotFound, "no Passenger instance "+strconv.Quote(name))
+		return nil, time.Time{}, false
+	}
+	info, readAt, err := pools.Pool()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "failed to read pool.xml: "+err.Error())
+		return nil, time.Time{}, false
+	}
+	return info, readAt, true
+}
+
+func newAPIInstance(name string, info *collector.Info, readAt time.Time, err error) apiInstance {
+	instance := apiInstance{Name: name, ReadAt: readAt}
+	if err != nil {
+		instance.Error = err.Error()
+		return instance
+	}
+	instance.PassengerVersion = info.PassengerVersion
+	instance.AppCount = atoi(info.AppCount)
+	instance.ProcessCount = atoi(info.CurrentProcessCount)
+	instance.MaxProcessCount = atoi(info.MaxProcessCount)
+	instance.CapacityUsed = atoi(info.CapacityUsed)
+	instance.RequestsInQueue = atoi(info.TopLevelRequestsInQueue)
+	return instance
+}
+
+func newAPIApp(sg *collector.SuperGroup, namer *collector.AppNamer) apiApp {
+	app := apiApp{
+		Name:            sg.Name,
+		State:           sg.State,
+		CapacityUsed:    atoi(sg.CapacityUsed),
+		RequestsInQueue: atoi(sg.RequestsInQueue),
+		Groups:          make([]apiGroup, 0, len(sg.Groups)),
+	}
+	app.App, app.Environment = namer.Name(sg)
+	for _, group := range sg.Groups {
+		app.ProcessCount += len(group.Processes)
+		app.Groups = append(app.Groups, apiGroup{
+			Name:              group.Name,
+			Component:         group.ComponentName,
+			Default:           group.Default == "true",
+			AppRoot:           group.AppRoot,
+			AppType:           group.AppType,
+			Environment:       group.Environment,
+			LifeStatus:        group.LifeStatus,
+			CapacityUsed:      atoi(group.CapacityUsed),
+			RequestsInQueue:   atoi(group.GetWaitListSize),
+			ProcessCount:      len(group.Processes),
+			ProcessesSpawning: atoi(group.ProcessesSpawning),
+		})
+	}
+	return app
+}
+
+func newAPIProcess(name, group string, proc *collector.Process) apiProcess {
+	memory, _ := strconv.ParseInt(proc.RealMemory, 10, 64)
+	return apiProcess{
+		Name:              name,
+		Group:             group,
+		PID:               atoi(proc.PID),
+		GUPID:             proc.GUPID,
+		LifeStatus:        proc.LifeStatus,
+		Enabled:           proc.Enabled,
+		Sessions:          atoi(proc.Sessions),
+		Concurrency:       atoi(proc.Concurrency),
+		Busyness:          atoi(proc.Busyness),
+		RequestsProcessed: atoi(proc.RequestsProcessed),
+		CPU:               atoi(proc.CPU),
+		MemoryBytes:       memory * 1024,
+		StartedAt:         microseconds(proc.SpawnEndTime),
+		LastUsed:          microseconds(proc.LastUsed),
+	}
+}
+
+// atoi returns 0 for values missing from the schema version of pool.xml.
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// microseconds converts a time in microseconds since the epoch, returning
+// nil if it is missing.
+func microseconds(s string) *time.Time {
+	us, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || us == 0 {
+		return nil
+	}
+	t := time.UnixMicro(us).UTC()
+	return &t
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,189 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nex-health/passenger-exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const apiInstanceName = "passenger.AbCdEfG"
+
+// newTestAPI serves the API from a collector reading the Passenger 6 fixture,
+// or failing with err if set, returning the number of pools read.
+func newTestAPI(t *testing.T, err error) (http.Handler, *collector.Collector, *int) {
+	t.Helper()
+	fixture, readErr := os.ReadFile("../collector/testdata/synthetic_passenger6_xml_output.xml")
+	if readErr != nil {
+		t.Fatalf("failed to read fixture: %v", readErr)
+	}
+	reads := 0
+	reader := &fakeReader{ReaderFunc: func() (io.ReadCloser, error) {
+		reads++
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(fixture)), nil
+	}}
+	c := collector.New(reader, collector.WithReadInterval(time.Hour))
+	instance := func() (string, error) { return apiInstanceName, nil }
+	return API(c, instance, collector.AppNamer{Source: collector.NameSourceName}), c, &reads
+}
+
+func get(t *testing.T, h http.Handler, path string, wantStatus int, v any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != wantStatus {
+		t.Fatalf("GET %s: expected status %d, got %d: %s", path, wantStatus, rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("GET %s: expected JSON, got %q", path, got)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("GET %s: failed to decode %s: %v", path, rec.Body.String(), err)
+	}
+}
+
+func TestAPI_Instances(t *testing.T) {
+	h, _, _ := newTestAPI(t, nil)
+
+	var instances []apiInstance
+	get(t, h, "/api/v1/instances", http.StatusOK, &instances)
+	if len(instances) != 1 {
+		t.Fatalf("expected 1 instance, got %+v", instances)
+	}
+	if instances[0].ReadAt.IsZero() {
+		t.Errorf("expected the time the pool was read, got %+v", instances[0])
+	}
+	want := apiInstance{
+		Name:             apiInstanceName,
+		ReadAt:           instances[0].ReadAt,
+		PassengerVersion: "6.0.23",
+		AppCount:         2,
+		ProcessCount:     3,
+		MaxProcessCount:  6,
+		CapacityUsed:     3,
+	}
+	if instances[0] != want {
+		t.Errorf("expected %+v, got %+v", want, instances[0])
+	}
+
+	var instance apiInstance
+	get(t, h, "/api/v1/instances/"+apiInstanceName, http.StatusOK, &instance)
+	if !instance.ReadAt.Equal(want.ReadAt) {
+		t.Errorf("expected the pool read for the list, got %+v", instance)
+	}
+	instance.ReadAt = want.ReadAt
+	if instance != want {
+		t.Errorf("expected %+v, got %+v", want, instance)
+	}
+}
+
+func TestAPI_Apps(t *testing.T) {
+	h, _, _ := newTestAPI(t, nil)
+
+	var apps []apiApp
+	get(t, h, "/api/v1/instances/"+apiInstanceName+"/apps", http.StatusOK, &apps)
+	if len(apps) != 2 {
+		t.Fatalf("expected 2 apps, got %+v", apps)
+	}
+	app := apps[0]
+	if app.Name != "/srv/app/web (production)" || app.App != "/srv/app/web" || app.Environment != "production" ||
+		app.RequestsInQueue != 1 || app.CapacityUsed != 2 || app.ProcessCount != 2 {
+		t.Errorf("unexpected app %+v", app)
+	}
+	if len(app.Groups) != 1 || !app.Groups[0].Default || app.Groups[0].AppType != "rack" || app.Groups[0].LifeStatus != "ALIVE" {
+		t.Errorf("unexpected groups %+v", app.Groups)
+	}
+}
+
+func TestAPI_Processes(t *testing.T) {
+	h, _, _ := newTestAPI(t, nil)
+
+	var processes []apiProcess
+	get(t, h, "/api/v1/instances/"+apiInstanceName+"/processes", http.StatusOK, &processes)
+	if len(processes) != 3 {
+		t.Fatalf("expected 3 processes, got %+v", processes)
+	}
+	proc := processes[0]
+	if proc.Name != "/srv/app/web (production)" || proc.App != "/srv/app/web" || proc.Environment != "production" {
+		t.Errorf("unexpected app of process %+v", proc)
+	}
+	if proc.PID != 3101 || proc.GUPID != "2c3d4e5-AbCdEfGhIj" || proc.Sessions != 1 || proc.Concurrency != 1 ||
+		proc.RequestsProcessed != 5120 || proc.MemoryBytes != 260000*1024 || proc.Enabled != "ENABLED" {
+		t.Errorf("unexpected process %+v", proc)
+	}
+	if want := time.UnixMicro(1714991400123456).UTC(); proc.LastUsed == nil || !proc.LastUsed.Equal(want) {
+		t.Errorf("expected last used %s, got %v", want, proc.LastUsed)
+	}
+
+	get(t, h, "/api/v1/instances/"+apiInstanceName+"/processes?name=/srv/app/api+(production)", http.StatusOK, &processes)
+	if len(processes) != 1 || processes[0].PID != 3201 {
+		t.Errorf("expected the process of api, got %+v", processes)
+	}
+}
+
+func TestAPI_Errors(t *testing.T) {
+	h, _, _ := newTestAPI(t, errors.New("connection refused"))
+
+	for _, tc := range []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/api/v1/instances/passenger.XXXXXXX/apps", http.StatusNotFound},
+		{"/api/v1/instances/" + apiInstanceName + "/apps", http.StatusBadGateway},
+		{"/api/v1/instances/" + apiInstanceName, http.StatusBadGateway},
+	} {
+		var body map[string]string
+		get(t, h, tc.path, tc.wantStatus, &body)
+		if body["error"] == "" {
+			t.Errorf("GET %s: expected an error, got %v", tc.path, body)
+		}
+	}
+
+	var instances []apiInstance
+	get(t, h, "/api/v1/instances", http.StatusOK, &instances)
+	if len(instances) != 1 || !strings.Contains(instances[0].Error, "connection refused") {
+		t.Errorf("expected a read error, got %+v", instances)
+	}
+}
+
+// TestAPI_SharesReads checks the API serves the pool the metrics are exported
+// from, instead of reading Passenger again.
+func TestAPI_SharesReads(t *testing.T) {
+	h, c, reads := newTestAPI(t, nil)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	if _, err := registry.Gather(); err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+	var apps []apiApp
+	get(t, h, "/api/v1/instances/"+apiInstanceName+"/apps", http.StatusOK, &apps)
+	if *reads != 1 {
+		t.Errorf("expected the scrape and the API to share a read, got %d reads", *reads)
+	}
+}
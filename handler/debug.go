@@ -0,0 +1,77 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package handler implements the HTTP endpoints served next to the metrics.
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/nex-health/passenger-exporter/collector"
+)
+
+const redacted = "<secret>"
+
+// PoolXML serves pool.xml exactly as returned by reader.
+func PoolXML(reader collector.MetricsReader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		data, err := reader.Read()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer data.Close()
+
+		w.Header().Set("Content-Type", "application/xml")
+		io.Copy(w, data)
+	})
+}
+
+// PoolJSON serves the parsed pool.xml as JSON, with secrets from the
+// application options redacted.
+func PoolJSON(reader collector.MetricsReader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		data, err := reader.Read()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer data.Close()
+
+		info, err := collector.Parse(data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		redact(info)
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(info)
+	})
+}
+
+// redact blanks secrets in place.
+func redact(info *collector.Info) {
+	for i := range info.SuperGroups {
+		for j := range info.SuperGroups[i].Groups {
+			options := &info.SuperGroups[i].Groups[j].Options
+			if options.USTRouterPassword != "" {
+				options.USTRouterPassword = redacted
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nex-health/passenger-exporter/collector"
+)
+
+const fixturePath = "../collector/testdata/passenger_xml_output.xml"
+
+type fakeReader struct {
+	ReaderFunc func() (io.ReadCloser, error)
+}
+
+func (r *fakeReader) Read() (io.ReadCloser, error) {
+	return r.ReaderFunc()
+}
+
+func fixtureReader(t *testing.T) *fakeReader {
+	fixture, err := os.ReadFile(fixturePath)
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	return &fakeReader{ReaderFunc: func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(fixture)), nil
+	}}
+}
+
+func TestPoolXML(t *testing.T) {
+	fixture, err := os.ReadFile(fixturePath)
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	PoolXML(fixtureReader(t)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pool.xml", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), fixture) {
+		t.Errorf("served data different from fixture")
+	}
+}
+
+func TestPoolJSON(t *testing.T) {
+	rec := httptest.NewRecorder()
+	PoolJSON(fixtureReader(t)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pool.json", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "cdf456abc123") {
+		t.Errorf("expected ust_router_password to be redacted")
+	}
+
+	var info collector.Info
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if want, got := "5.0.26", info.PassengerVersion; want != got {
+		t.Errorf("expected passenger version %q, got %q", want, got)
+	}
+	if want, got := redacted, info.SuperGroups[0].Groups[0].Options.USTRouterPassword; want != got {
+		t.Errorf("expected ust_router_password %q, got %q", want, got)
+	}
+	if want, got := 48, len(info.SuperGroups[0].Groups[0].Processes); want != got {
+		t.Errorf("expected %d processes, got %d", want, got)
+	}
+}
+
+func TestDebug_Errors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		handler func(collector.MetricsReader) http.Handler
+		reader  func() (io.ReadCloser, error)
+	}{
+		{
+			name:    "pool.xml with reader error",
+			handler: PoolXML,
+			reader:  func() (io.ReadCloser, error) { return nil, fmt.Errorf("fake") },
+		},
+		{
+			name:    "pool.json with reader error",
+			handler: PoolJSON,
+			reader:  func() (io.ReadCloser, error) { return nil, fmt.Errorf("fake") },
+		},
+		{
+			name:    "pool.json with malformed xml",
+			handler: PoolJSON,
+			reader:  func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader("<info>")), nil },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tc.handler(&fakeReader{ReaderFunc: tc.reader}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != http.StatusBadGateway {
+				t.Errorf("expected status %d, got %d", http.StatusBadGateway, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nex-health/passenger-exporter/collector"
+	"github.com/nex-health/passenger-exporter/events"
+	"github.com/prometheus/common/promslog"
+)
+
+func TestEvents(t *testing.T) {
+	log := events.New(10, 0, collector.AppNamer{}, promslog.NewNopLogger())
+	start := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	log.Observe(start, &collector.Info{})
+	log.Observe(start.Add(time.Minute), &collector.Info{SuperGroups: []collector.SuperGroup{{Name: "web"}}})
+	log.Observe(start.Add(2*time.Minute), &collector.Info{SuperGroups: []collector.SuperGroup{{Name: "api"}}})
+
+	for _, tc := range []struct {
+		query      string
+		wantStatus int
+		wantTypes  []string
+	}{
+		{query: "", wantStatus: http.StatusOK, wantTypes: []string{events.AppAdded, events.AppAdded, events.AppRemoved}},
+		{query: "?since=2024-05-06T07:10:09Z", wantStatus: http.StatusOK, wantTypes: []string{events.AppAdded, events.AppRemoved}},
+		{query: "?since=2024-05-06T08:00:00Z", wantStatus: http.StatusOK, wantTypes: []string{}},
+		{query: "?since=yesterday", wantStatus: http.StatusBadRequest},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Events(log).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/events"+tc.query, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d", tc.wantStatus, rec.Code)
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var got []events.Event
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to decode events: %v", err)
+			}
+			if got == nil {
+				t.Fatalf("expected a JSON array, got %s", rec.Body.String())
+			}
+			types := []string{}
+			for _, event := range got {
+				types = append(types, event.Type)
+			}
+			if !slices.Equal(types, tc.wantTypes) {
+				t.Errorf("expected events %v, got %v", tc.wantTypes, types)
+			}
+		})
+	}
+}
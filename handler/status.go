@@ -0,0 +1,153 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/nex-health/passenger-exporter/collector"
+	"github.com/prometheus/exporter-toolkit/web"
+)
+
+// Scraper reports the outcome of the last scrape.
+type Scraper interface {
+	LastScrape() (time.Time, error)
+}
+
+var statusTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"megabytes": func(kilobytes string) string {
+		v, err := strconv.ParseFloat(kilobytes, 64)
+		if err != nil {
+			return kilobytes
+		}
+		return strconv.FormatFloat(v/1024, 'f', 0, 64) + " MB"
+	},
+}).Parse(`<h2>Last scrape</h2>
+{{- if .LastScrape.IsZero }}
+<p>Not scraped yet.</p>
+{{- else if .LastScrapeErr }}
+<p>{{ .LastScrape.Format "2006-01-02T15:04:05Z07:00" }}: failed with <code>{{ .LastScrapeErr }}</code></p>
+{{- else }}
+<p>{{ .LastScrape.Format "2006-01-02T15:04:05Z07:00" }}: OK</p>
+{{- end }}
+{{- if .InstancesErr }}
+<h2>Instances</h2>
+<p>Failed to discover Passenger instances: <code>{{ .InstancesErr }}</code></p>
+{{- else if not .Instances }}
+<h2>Instances</h2>
+<p>No Passenger instances found.</p>
+{{- end }}
+{{- range .Instances }}
+<h2>Instance {{ .Name }}</h2>
+{{- if .Err }}
+<p>Failed to read pool.xml: <code>{{ .Err }}</code></p>
+{{- else }}
+{{- with .Info }}
+<table>
+  <tr><th>Version</th><td>{{ .PassengerVersion }}</td></tr>
+  <tr><th>Processes</th><td>{{ .CurrentProcessCount }} / {{ .MaxProcessCount }}</td></tr>
+  <tr><th>Apps</th><td>{{ .AppCount }}</td></tr>
+  <tr><th>Requests in top-level queue</th><td>{{ .TopLevelRequestsInQueue }}</td></tr>
+</table>
+{{- range .SuperGroups }}
+<h3>{{ .Name }}</h3>
+<p>State: {{ .State }}, requests in queue: {{ .RequestsInQueue }}</p>
+{{- range .Groups }}
+<h4>{{ .ComponentName }}{{ if eq .Default "true" }} (default){{ end }}</h4>
+<p>Requests in group queue: {{ .GetWaitListSize }}, processes spawning: {{ .ProcessesSpawning }}</p>
+<table>
+  <tr><th>PID</th><th>Memory</th><th>Sessions</th><th>Processed</th><th>Busyness</th><th>Uptime</th><th>Life status</th></tr>
+  {{- range .Processes }}
+  <tr><td>{{ .PID }}</td><td>{{ megabytes .RealMemory }}</td><td>{{ .Sessions }}</td><td>{{ .RequestsProcessed }}</td><td>{{ .Busyness }}</td><td>{{ .Uptime }}</td><td>{{ .LifeStatus }}</td></tr>
+  {{- end }}
+</table>
+{{- end }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- end }}
+`))
+
+const statusCSS = `table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { text-align: left; padding: 0.2em 1em 0.2em 0; }`
+
+type statusData struct {
+	LastScrape    time.Time
+	LastScrapeErr error
+	InstancesErr  error
+	Instances     []instanceStatus
+}
+
+type instanceStatus struct {
+	Name string
+	Info *collector.Info
+	Err  error
+}
+
+// Status serves the landing page described by config, followed by a live
+// overview of every Passenger instance found by reader.
+func Status(config web.LandingConfig, reader collector.InstanceReader, scraper Scraper) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Everything below "/" is routed here, only the landing page
+		// itself is worth asking Passenger for its status.
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		var data statusData
+		data.LastScrape, data.LastScrapeErr = scraper.LastScrape()
+
+		names, err := reader.Instances()
+		data.InstancesErr = err
+		for _, name := range names {
+			info, err := readInstance(reader, name)
+			data.Instances = append(data.Instances, instanceStatus{Name: name, Info: info, Err: err})
+		}
+
+		var buf bytes.Buffer
+		if err := statusTemplate.Execute(&buf, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// The landing page is rendered once on creation, so it is
+		// recreated with the current status on every request.
+		pageConfig := config
+		pageConfig.Links = slices.Clone(config.Links)
+		pageConfig.ExtraHTML = config.ExtraHTML + buf.String()
+		pageConfig.ExtraCSS = config.ExtraCSS + statusCSS
+		page, err := web.NewLandingPage(pageConfig)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		page.ServeHTTP(w, r)
+	})
+}
+
+func readInstance(reader collector.InstanceReader, name string) (*collector.Info, error) {
+	data, err := reader.ReadInstance(name)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+
+	return collector.Parse(data)
+}
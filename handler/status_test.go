@@ -0,0 +1,146 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/exporter-toolkit/web"
+)
+
+type fakeInstanceReader struct {
+	instances map[string][]byte
+	names     []string
+	err       error
+}
+
+func (r *fakeInstanceReader) Instances() ([]string, error) {
+	return r.names, r.err
+}
+
+func (r *fakeInstanceReader) ReadInstance(name string) (io.ReadCloser, error) {
+	data, ok := r.instances[name]
+	if !ok {
+		return nil, fmt.Errorf("dial unix /tmp/%s/agents.s/core_api: connect: no such file or directory", name)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+type fakeScraper struct {
+	at  time.Time
+	err error
+}
+
+func (s fakeScraper) LastScrape() (time.Time, error) {
+	return s.at, s.err
+}
+
+func TestStatus_NotFound(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Status(web.LandingConfig{}, &fakeInstanceReader{}, fakeScraper{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	fixture, err := os.ReadFile(fixturePath)
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		reader   *fakeInstanceReader
+		scraper  fakeScraper
+		want     []string
+		dontWant []string
+	}{
+		{
+			name: "instances",
+			reader: &fakeInstanceReader{
+				names:     []string{"passenger.aBc0d2z", "passenger.zk9bVz7"},
+				instances: map[string][]byte{"passenger.aBc0d2z": fixture},
+			},
+			scraper: fakeScraper{at: time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)},
+			want: []string{
+				"Phusion Passenger Exporter",
+				`<a href="/metrics">Metrics</a>`,
+				"2024-05-06T07:08:09Z: OK",
+				"<h2>Instance passenger.aBc0d2z</h2>",
+				"<tr><th>Version</th><td>5.0.26</td></tr>",
+				"<tr><th>Processes</th><td>48 / 48</td></tr>",
+				"<tr><th>Requests in top-level queue</th><td>3</td></tr>",
+				"<h3>/srv/app/my_app (production)</h3>",
+				"requests in queue: 5",
+				"<h4>/srv/app/my_app (production) (default)</h4>",
+				"<tr><td>1402</td><td>322 MB</td><td>1</td><td>43578</td><td>2147483647</td><td>34m 54s</td><td>ALIVE</td></tr>",
+				"<h2>Instance passenger.zk9bVz7</h2>",
+				"Failed to read pool.xml: <code>dial unix /tmp/passenger.zk9bVz7/agents.s/core_api: connect: no such file or directory</code>",
+			},
+			dontWant: []string{"cdf456abc123"},
+		},
+		{
+			name:    "scrape error",
+			reader:  &fakeInstanceReader{},
+			scraper: fakeScraper{at: time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC), err: fmt.Errorf("EOF")},
+			want: []string{
+				"2024-05-06T07:08:09Z: failed with <code>EOF</code>",
+				"No Passenger instances found.",
+			},
+		},
+		{
+			name:    "not scraped yet",
+			reader:  &fakeInstanceReader{err: fmt.Errorf("syntax error in pattern")},
+			scraper: fakeScraper{},
+			want: []string{
+				"Not scraped yet.",
+				"Failed to discover Passenger instances: <code>syntax error in pattern</code>",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := web.LandingConfig{
+				Name:  "Phusion Passenger Exporter",
+				Links: []web.LandingLinks{{Address: "/metrics", Text: "Metrics"}},
+			}
+			rec := httptest.NewRecorder()
+			Status(config, tc.reader, tc.scraper).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+			body := rec.Body.String()
+			for _, want := range tc.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("expected page to contain %q", want)
+				}
+			}
+			for _, dontWant := range tc.dontWant {
+				if strings.Contains(body, dontWant) {
+					t.Errorf("expected page not to contain %q", dontWant)
+				}
+			}
+		})
+	}
+}
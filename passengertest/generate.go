@@ -0,0 +1,282 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package passengertest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/nex-health/passenger-exporter/collector"
+)
+
+// Spec describes a synthetic pool. Zero values get sensible defaults.
+type Spec struct {
+	// PassengerVersion defaults to 6.0.23.
+	PassengerVersion string
+	// Apps defaults to 1.
+	Apps int
+	// ProcessesPerApp defaults to 4.
+	ProcessesPerApp int
+	// MaxProcesses defaults to Apps * ProcessesPerApp.
+	MaxProcesses int
+
+	// Memory is the real memory of a process in kilobytes, defaults to
+	// 200000. Every process gets up to MemoryJitter kilobytes on top.
+	Memory       int64
+	MemoryJitter int64
+
+	// TopLevelQueue and AppQueue are the number of requests waiting in the
+	// top-level queue and in the queue of every app.
+	TopLevelQueue int
+	AppQueue      int
+
+	// LifeStatuses are assigned to the processes of every app in turn,
+	// defaults to ALIVE only.
+	LifeStatuses []string
+	// Sessions are assigned to the processes of every app in turn, defaults
+	// to idle processes. Processes have a concurrency of 1.
+	Sessions []int
+
+	// Now is the time the pool is observed at, defaults to the current
+	// time.
+	Now time.Time
+	// Seed makes the memory jitter reproducible.
+	Seed uint64
+
+	// Enterprise adds the rolling restart state Passenger Enterprise
+	// reports.
+	Enterprise bool
+}
+
+// Generate builds a synthetic pool. Apps are named /srv/app/appN (production)
+// and PIDs count up from 1000.
+func Generate(spec Spec) *collector.Info {
+	return generate(spec.withDefaults(), &pidAllocator{next: 1000})
+}
+
+func (spec Spec) withDefaults() Spec {
+	if spec.PassengerVersion == "" {
+		spec.PassengerVersion = "6.0.23"
+	}
+	if spec.Apps == 0 {
+		spec.Apps = 1
+	}
+	if spec.ProcessesPerApp == 0 {
+		spec.ProcessesPerApp = 4
+	}
+	if spec.MaxProcesses == 0 {
+		spec.MaxProcesses = spec.Apps * spec.ProcessesPerApp
+	}
+	if spec.Memory == 0 {
+		spec.Memory = 200000
+	}
+	if len(spec.LifeStatuses) == 0 {
+		spec.LifeStatuses = []string{"ALIVE"}
+	}
+	if spec.Now.IsZero() {
+		spec.Now = time.Now()
+	}
+	return spec
+}
+
+func generate(spec Spec, pids *pidAllocator) *collector.Info {
+	rng := rand.New(rand.NewPCG(spec.Seed, spec.Seed))
+
+	info := &collector.Info{
+		SchemaVersion:           collector.SchemaVersion3,
+		PassengerVersion:        spec.PassengerVersion,
+		MaxProcessCount:         strconv.Itoa(spec.MaxProcesses),
+		TopLevelRequestsInQueue: strconv.Itoa(spec.TopLevelQueue),
+	}
+
+	for app := 0; app < spec.Apps; app++ {
+		root := fmt.Sprintf("/srv/app/app%d", app)
+		name := root + " (production)"
+
+		group := collector.Group{
+			Name:                name,
+			ComponentName:       name,
+			AppRoot:             root,
+			AppType:             "rack",
+			Environment:         "production",
+			Default:             "true",
+			LifeStatus:          "ALIVE",
+			User:                "app",
+			UID:                 "5001",
+			GID:                 "1",
+			UUID:                randomString(20),
+			GetWaitListSize:     "0",
+			DisableWaitListSize: "0",
+			ProcessesSpawning:   "0",
+			Options: collector.Options{
+				AppRoot:              root,
+				AppGroupName:         name,
+				AppType:              "rack",
+				Environment:          "production",
+				SpawnMethod:          "smart",
+				StartCommand:         "ruby\t/usr/share/passenger/helper-scripts/rack-loader.rb",
+				StartupFile:          root + "/config.ru",
+				MinProcesses:         strconv.Itoa(spec.ProcessesPerApp),
+				MaxPreloaderIdleTime: "300",
+				MaxRequestQueueSize:  "100",
+				IntegrationMode:      "nginx",
+			},
+		}
+
+		if spec.Enterprise {
+			group.Restarting = "false"
+			group.RestartsInitiated = "0"
+		}
+
+		for i := 0; i < spec.ProcessesPerApp; i++ {
+			proc := NewProcess(pids.Next(), spec.Now.Add(-time.Duration(spec.ProcessesPerApp-i)*time.Minute), spec.Now)
+			proc.RealMemory = strconv.FormatInt(spec.Memory+jitter(rng, spec.MemoryJitter), 10)
+			proc.LifeStatus = spec.LifeStatuses[i%len(spec.LifeStatuses)]
+			if len(spec.Sessions) > 0 {
+				proc.Sessions = strconv.Itoa(spec.Sessions[i%len(spec.Sessions)])
+			}
+			proc.Command = "Passenger RubyApp: " + name
+			group.Processes = append(group.Processes, proc)
+		}
+
+		info.SuperGroups = append(info.SuperGroups, collector.SuperGroup{
+			Name:            name,
+			State:           "READY",
+			RequestsInQueue: strconv.Itoa(spec.AppQueue),
+			Groups:          []collector.Group{group},
+		})
+	}
+
+	updateCounts(info)
+	return info
+}
+
+// NewProcess builds an idle process spawned at spawned, observed at now.
+func NewProcess(pid int, spawned, now time.Time) collector.Process {
+	return collector.Process{
+		PID:                 strconv.Itoa(pid),
+		GUPID:               randomString(7) + "-" + randomString(10),
+		StickySessionID:     strconv.Itoa(pid * 7919),
+		Concurrency:         "1",
+		Sessions:            "0",
+		Busyness:            "0",
+		RequestsProcessed:   "0",
+		SpawnerCreationTime: microseconds(spawned.Add(-time.Hour)),
+		SpawnStartTime:      microseconds(spawned),
+		SpawnEndTime:        microseconds(spawned.Add(5 * time.Second)),
+		LastUsed:            microseconds(spawned),
+		LastUsedDesc:        formatDuration(now.Sub(spawned)) + " ago",
+		Uptime:              formatDuration(now.Sub(spawned)),
+		LifeStatus:          "ALIVE",
+		Enabled:             "ENABLED",
+		HasMetrics:          "true",
+		CPU:                 "0",
+		RealMemory:          "200000",
+		RSS:                 "200000",
+		PSS:                 "200000",
+		PrivateDirty:        "200000",
+		Swap:                "0",
+		VMSize:              "500000",
+		ProcessGroupID:      strconv.Itoa(pid),
+		CodeRevision:        "4fef3ec",
+	}
+}
+
+// MarshalXML serializes info the way the Passenger core API serves
+// /pool.xml, as schema version 3 unless info says otherwise.
+func MarshalXML(info *collector.Info) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8" ?>` + "\n")
+
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if info.SchemaVersion == "" {
+		withVersion := *info
+		withVersion.SchemaVersion = collector.SchemaVersion3
+		info = &withVersion
+	}
+	if err := encoder.EncodeElement(info, xml.StartElement{Name: xml.Name{Local: "info"}}); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// updateCounts recomputes the pool wide counts from the supergroups.
+func updateCounts(info *collector.Info) {
+	processes := 0
+	for i := range info.SuperGroups {
+		sg := &info.SuperGroups[i]
+		sgProcesses := 0
+		for j := range sg.Groups {
+			group := &sg.Groups[j]
+			group.CapacityUsed = strconv.Itoa(len(group.Processes))
+			group.EnabledProcessCount = group.CapacityUsed
+			group.DisablingProcessCount = "0"
+			group.DisabledProcessCount = "0"
+			sgProcesses += len(group.Processes)
+		}
+		sg.CapacityUsed = strconv.Itoa(sgProcesses)
+		processes += sgProcesses
+	}
+	info.AppCount = strconv.Itoa(len(info.SuperGroups))
+	info.CurrentProcessCount = strconv.Itoa(processes)
+	info.CapacityUsed = info.CurrentProcessCount
+}
+
+type pidAllocator struct {
+	next int
+}
+
+func (a *pidAllocator) Next() int {
+	pid := a.next
+	a.next++
+	return pid
+}
+
+func jitter(rng *rand.Rand, max int64) int64 {
+	if max <= 0 {
+		return 0
+	}
+	return rng.Int64N(max)
+}
+
+func microseconds(t time.Time) string {
+	return strconv.FormatInt(t.UnixMicro(), 10)
+}
+
+// formatDuration formats like Passenger does, e.g. 34m 54s.
+func formatDuration(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	var (
+		hours   = int(d.Hours())
+		minutes = int(d.Minutes()) % 60
+		seconds = int(d.Seconds()) % 60
+	)
+	switch {
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm %ds", hours, minutes, seconds)
+	case minutes > 0:
+		return fmt.Sprintf("%dm %ds", minutes, seconds)
+	default:
+		return fmt.Sprintf("%ds", seconds)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package passengertest
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nex-health/passenger-exporter/collector"
+)
+
+var testTime = time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+func TestGenerate(t *testing.T) {
+	info := Generate(Spec{
+		Apps:            3,
+		ProcessesPerApp: 5,
+		MemoryJitter:    1000,
+		AppQueue:        2,
+		LifeStatuses:    []string{"ALIVE", "SHUTTING_DOWN"},
+		Sessions:        []int{1, 0},
+		Now:             testTime,
+	})
+
+	if want, got := "15", info.CurrentProcessCount; want != got {
+		t.Errorf("expected process count %s, got %s", want, got)
+	}
+	if want, got := "3", info.AppCount; want != got {
+		t.Errorf("expected app count %s, got %s", want, got)
+	}
+	if want, got := "/srv/app/app2 (production)", info.SuperGroups[2].Name; want != got {
+		t.Errorf("expected app name %q, got %q", want, got)
+	}
+	if want, got := "1005", info.SuperGroups[1].Groups[0].Processes[0].PID; want != got {
+		t.Errorf("expected pid %s, got %s", want, got)
+	}
+	if want, got := "SHUTTING_DOWN", info.SuperGroups[0].Groups[0].Processes[1].LifeStatus; want != got {
+		t.Errorf("expected life status %s, got %s", want, got)
+	}
+	if want, got := "0", info.SuperGroups[0].Groups[0].Processes[3].Sessions; want != got {
+		t.Errorf("expected sessions %s, got %s", want, got)
+	}
+	if want, got := "5m 0s", info.SuperGroups[0].Groups[0].Processes[0].Uptime; want != got {
+		t.Errorf("expected uptime %q, got %q", want, got)
+	}
+	for _, sg := range info.SuperGroups {
+		for _, proc := range sg.Groups[0].Processes {
+			if memory := parseInt(proc.RealMemory); memory < 200000 || memory >= 201000 {
+				t.Errorf("expected memory within jitter, got %d", memory)
+			}
+		}
+	}
+}
+
+func TestMarshalXML(t *testing.T) {
+	info := Generate(Spec{Apps: 2, ProcessesPerApp: 3, Now: testTime})
+
+	data, err := MarshalXML(info)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	parsed, err := collector.Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if !reflect.DeepEqual(info, parsed) {
+		t.Errorf("parsed pool differs from generated pool")
+	}
+}
+
+func TestSimulation(t *testing.T) {
+	sim := NewSimulation(
+		Spec{Apps: 2, ProcessesPerApp: 4, Now: testTime},
+		RollingRestart(0, 2, 1),
+		MemoryLeak(1, 0, 100),
+		QueueSurge(1, 1, 4, 10),
+	)
+
+	var (
+		pids   [][]string
+		queues []string
+	)
+	for i := 0; i < 6; i++ {
+		sim.Step()
+		info := sim.Info()
+
+		var stepPIDs []string
+		for _, proc := range info.SuperGroups[0].Groups[0].Processes {
+			stepPIDs = append(stepPIDs, proc.PID)
+		}
+		pids = append(pids, stepPIDs)
+		queues = append(queues, info.SuperGroups[1].RequestsInQueue)
+	}
+
+	wantPIDs := [][]string{
+		{"1000", "1001", "1002", "1003"},
+		{"1001", "1002", "1003", "1008"},
+		{"1002", "1003", "1008", "1009"},
+		{"1003", "1008", "1009", "1010"},
+		{"1008", "1009", "1010", "1011"},
+		{"1008", "1009", "1010", "1011"},
+	}
+	if !reflect.DeepEqual(wantPIDs, pids) {
+		t.Errorf("expected rolling restart to go through pids %v, got %v", wantPIDs, pids)
+	}
+
+	wantQueues := []string{"0", "5", "10", "5", "0", "0"}
+	if !reflect.DeepEqual(wantQueues, queues) {
+		t.Errorf("expected queue surge %v, got %v", wantQueues, queues)
+	}
+
+	info := sim.Info()
+	if want, got := "200600", info.SuperGroups[1].Groups[0].Processes[0].RealMemory; want != got {
+		t.Errorf("expected leaking process to use %s kB, got %s", want, got)
+	}
+	if want, got := testTime.Add(time.Minute), sim.Now(); !want.Equal(got) {
+		t.Errorf("expected simulated time %v, got %v", want, got)
+	}
+}
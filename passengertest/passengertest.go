@@ -0,0 +1,238 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package passengertest provides a fake Passenger instance for tests: an
+// instance registry directory with password files and a core API socket
+// serving scripted responses.
+package passengertest
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nex-health/passenger-exporter/collector"
+)
+
+const (
+	// FullAdminUsername and FullAdminPasswordFile are the credentials
+	// Passenger grants read-write access to the core API with.
+	FullAdminUsername     = collector.FullAdminUsername
+	FullAdminPasswordFile = collector.FullAdminPasswordFile
+
+	// MalformedXML is a truncated pool.xml.
+	MalformedXML = `<?xml version="1.0" encoding="iso8859-1" ?>
+<info version="3">
+  <passenger_version>6.0.23</passenger_version>
+  <supergroups>
+    <supergroup>`
+)
+
+// Response is a scripted core API response.
+type Response struct {
+	// Status defaults to 200 OK.
+	Status int
+	Body   []byte
+	// Delay is waited before responding.
+	Delay time.Duration
+}
+
+// Instance is a fake Passenger instance. Requests to paths without a scripted
+// response get a 404 Not Found, requests with wrong credentials a 401
+// Unauthorized, just like the real core API.
+type Instance struct {
+	// Registry is the instance registry directory, as passed to
+	// collector.NewUDSReader.
+	Registry string
+	// Name is the name of the instance, e.g. passenger.aBc0d2z.
+	Name string
+	// Dir is the instance directory, Registry/Name.
+	Dir string
+
+	ReadOnlyPassword  string
+	FullAdminPassword string
+
+	server *http.Server
+
+	mu        sync.Mutex
+	responses map[string]Response
+	requests  map[string]int
+	bodies    map[string][]byte
+	passwords map[string]string
+}
+
+// New starts a fake Passenger instance in a new instance registry directory.
+// It is stopped and removed when the test finishes.
+func New(tb testing.TB) *Instance {
+	tb.Helper()
+
+	// Unix socket paths are limited to around 100 bytes, which the
+	// directories of testing.TB.TempDir easily exceed.
+	registry, err := os.MkdirTemp("", "passengertest")
+	if err != nil {
+		tb.Fatalf("failed to create instance registry directory: %v", err)
+	}
+	tb.Cleanup(func() { os.RemoveAll(registry) })
+
+	inst, err := NewInstance(registry)
+	if err != nil {
+		tb.Fatalf("failed to start fake Passenger instance: %v", err)
+	}
+	tb.Cleanup(func() { inst.Close() })
+
+	return inst
+}
+
+// NewInstance starts a fake Passenger instance in the given instance registry
+// directory, next to any instances already in there. The caller must Close
+// it.
+func NewInstance(registry string) (*Instance, error) {
+	name := "passenger." + randomString(7)
+	dir := filepath.Join(registry, name)
+
+	if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(collector.UDSPath)), 0755); err != nil {
+		return nil, err
+	}
+
+	inst := &Instance{
+		Registry:          registry,
+		Name:              name,
+		Dir:               dir,
+		ReadOnlyPassword:  randomString(20),
+		FullAdminPassword: randomString(20),
+		responses:         make(map[string]Response),
+		requests:          make(map[string]int),
+		bodies:            make(map[string][]byte),
+	}
+	inst.passwords = map[string]string{
+		collector.ReadOnlyAdminUsername: inst.ReadOnlyPassword,
+		FullAdminUsername:               inst.FullAdminPassword,
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, collector.ReadOnlyAdminPasswordFile), []byte(inst.ReadOnlyPassword), 0600); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, FullAdminPasswordFile), []byte(inst.FullAdminPassword), 0600); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", filepath.Join(dir, collector.UDSPath))
+	if err != nil {
+		return nil, err
+	}
+	inst.server = &http.Server{Handler: http.HandlerFunc(inst.serveHTTP)}
+	go inst.server.Serve(listener)
+
+	return inst, nil
+}
+
+// Close stops serving the core API. The instance directory is left in place.
+func (i *Instance) Close() error {
+	return i.server.Close()
+}
+
+// Handle scripts the response to requests for path, e.g. /pool.xml.
+func (i *Instance) Handle(path string, resp Response) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.responses[path] = resp
+}
+
+// SetPoolXML scripts a successful /pool.xml response.
+func (i *Instance) SetPoolXML(body []byte) {
+	i.Handle("/pool.xml", Response{Body: body})
+}
+
+// SetServerJSON scripts a successful /server.json response.
+func (i *Instance) SetServerJSON(body []byte) {
+	i.Handle("/server.json", Response{Body: body})
+}
+
+// SetPassword changes the password the core API expects for username without
+// touching the password file, as if Passenger restarted while the registry
+// still held the old one.
+func (i *Instance) SetPassword(username, password string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.passwords[username] = password
+}
+
+// LastBody returns the body of the last request for path, nil if there was
+// none.
+func (i *Instance) LastBody(path string) []byte {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.bodies[path]
+}
+
+// Requests returns how many requests for path were answered, including
+// rejected ones.
+func (i *Instance) Requests(path string) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.requests[path]
+}
+
+func (i *Instance) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	i.mu.Lock()
+	i.requests[r.URL.Path]++
+	i.bodies[r.URL.Path] = body
+	resp, ok := i.responses[r.URL.Path]
+	username, password, _ := r.BasicAuth()
+	expected, known := i.passwords[username]
+	i.mu.Unlock()
+
+	if !known || subtle.ConstantTimeCompare([]byte(password), []byte(expected)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="api"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if resp.Delay > 0 {
+		select {
+		case <-time.After(resp.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write(resp.Body)
+}
+
+const alphanumerics = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	for i := range b {
+		b[i] = alphanumerics[int(b[i])%len(alphanumerics)]
+	}
+	return string(b)
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package passengertest
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nex-health/passenger-exporter/collector"
+)
+
+func get(t *testing.T, inst *Instance, path, username, password string) (int, string) {
+	client := http.Client{
+		Transport: &http.Transport{
+			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", filepath.Join(inst.Dir, collector.UDSPath))
+			},
+		},
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://unix"+path, nil)
+	req.SetBasicAuth(username, password)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestInstance(t *testing.T) {
+	inst := New(t)
+	inst.SetServerJSON([]byte(`{"threads": 1}`))
+
+	for file, want := range map[string]string{
+		collector.ReadOnlyAdminPasswordFile: inst.ReadOnlyPassword,
+		FullAdminPasswordFile:               inst.FullAdminPassword,
+	} {
+		got, err := os.ReadFile(filepath.Join(inst.Dir, file))
+		if err != nil {
+			t.Fatalf("failed to read password file: %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("expected %s to contain %q, got %q", file, want, got)
+		}
+	}
+
+	for _, tc := range []struct {
+		name       string
+		path       string
+		username   string
+		password   string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "read-only admin", path: "/server.json", username: collector.ReadOnlyAdminUsername, password: inst.ReadOnlyPassword, wantStatus: http.StatusOK, wantBody: `{"threads": 1}`},
+		{name: "full admin", path: "/server.json", username: FullAdminUsername, password: inst.FullAdminPassword, wantStatus: http.StatusOK, wantBody: `{"threads": 1}`},
+		{name: "wrong password", path: "/server.json", username: collector.ReadOnlyAdminUsername, password: inst.FullAdminPassword, wantStatus: http.StatusUnauthorized, wantBody: "Unauthorized\n"},
+		{name: "unscripted", path: "/pool.xml", username: collector.ReadOnlyAdminUsername, password: inst.ReadOnlyPassword, wantStatus: http.StatusNotFound, wantBody: "404 page not found\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := get(t, inst, tc.path, tc.username, tc.password)
+			if status != tc.wantStatus {
+				t.Errorf("expected status %d, got %d", tc.wantStatus, status)
+			}
+			if body != tc.wantBody {
+				t.Errorf("expected body %q, got %q", tc.wantBody, body)
+			}
+		})
+	}
+
+	if want, got := 3, inst.Requests("/server.json"); want != got {
+		t.Errorf("expected %d requests for /server.json, got %d", want, got)
+	}
+}
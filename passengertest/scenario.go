@@ -0,0 +1,249 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package passengertest
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nex-health/passenger-exporter/collector"
+)
+
+// State is the pool of a Simulation as handed to scenarios, which change it
+// in place.
+type State struct {
+	Info *collector.Info
+	// Step counts the steps taken, starting at 1.
+	Step int
+	Now  time.Time
+
+	pids *pidAllocator
+}
+
+// Spawn returns a freshly spawned process of the app with index app.
+func (s *State) Spawn(app int) collector.Process {
+	proc := NewProcess(s.pids.Next(), s.Now, s.Now)
+	proc.Command = "Passenger RubyApp: " + s.Info.SuperGroups[app].Name
+	return proc
+}
+
+// Scenario changes the pool in every step of a Simulation. The scenarios of
+// this package act on the default group of an app.
+type Scenario func(*State)
+
+// Simulation evolves a generated pool step by step, one step per scrape. On
+// every step the simulated clock advances by Interval and every idle alive
+// process serves one request, before the scenarios are applied in order.
+//
+// A Simulation is a collector.MetricsReader serving the current pool.
+type Simulation struct {
+	// Interval defaults to 10 seconds.
+	Interval time.Duration
+
+	mu        sync.Mutex
+	state     State
+	scenarios []Scenario
+}
+
+func NewSimulation(spec Spec, scenarios ...Scenario) *Simulation {
+	spec = spec.withDefaults()
+	pids := &pidAllocator{next: 1000}
+
+	return &Simulation{
+		Interval: 10 * time.Second,
+		state: State{
+			Info: generate(spec, pids),
+			Now:  spec.Now,
+			pids: pids,
+		},
+		scenarios: scenarios,
+	}
+}
+
+// Step advances the simulation by one step.
+func (s *Simulation) Step() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.Step++
+	s.state.Now = s.state.Now.Add(s.Interval)
+
+	for _, proc := range allProcesses(s.state.Info) {
+		if proc.LifeStatus == "ALIVE" && proc.Sessions == "0" {
+			proc.RequestsProcessed = strconv.FormatInt(parseInt(proc.RequestsProcessed)+1, 10)
+			proc.LastUsed = microseconds(s.state.Now)
+		}
+		spawned := time.UnixMicro(parseInt(proc.SpawnStartTime))
+		lastUsed := time.UnixMicro(parseInt(proc.LastUsed))
+		proc.Uptime = formatDuration(s.state.Now.Sub(spawned))
+		proc.LastUsedDesc = formatDuration(s.state.Now.Sub(lastUsed)) + " ago"
+	}
+
+	for _, scenario := range s.scenarios {
+		scenario(&s.state)
+	}
+	updateCounts(s.state.Info)
+}
+
+// Info returns a copy of the current pool.
+func (s *Simulation) Info() *collector.Info {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return clone(s.state.Info)
+}
+
+// Now returns the current simulated time.
+func (s *Simulation) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.Now
+}
+
+// Read serves the current pool as pool.xml.
+func (s *Simulation) Read() (io.ReadCloser, error) {
+	data, err := MarshalXML(s.Info())
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// RollingRestart replaces the processes of the app with index app with newly
+// spawned ones, perStep at a time from step start on, until all processes
+// that were running when it started are gone. Like Passenger, it removes the
+// oldest process and appends its replacement. In Enterprise pools the restart
+// is reported and replaced processes stay detached for one step.
+func RollingRestart(app, start, perStep int) Scenario {
+	var old map[string]bool
+	isOld := func(p collector.Process) bool { return old[p.PID] }
+	return func(s *State) {
+		if s.Step < start {
+			return
+		}
+		group := s.Info.SuperGroups[app].DefaultGroup()
+		enterprise := group.Restarting != ""
+		if enterprise {
+			group.DetachedProcesses = nil
+		}
+		if old == nil {
+			old = make(map[string]bool)
+			for _, proc := range group.Processes {
+				old[proc.PID] = true
+			}
+			if enterprise {
+				group.Restarting = "true"
+				group.RestartsInitiated = strconv.FormatInt(parseInt(group.RestartsInitiated)+1, 10)
+			}
+		}
+
+		for n := 0; n < perStep; n++ {
+			i := slices.IndexFunc(group.Processes, isOld)
+			if i < 0 {
+				break
+			}
+			if enterprise {
+				detached := group.Processes[i]
+				detached.LifeStatus = "SHUTTING_DOWN"
+				group.DetachedProcesses = append(group.DetachedProcesses, detached)
+			}
+			group.Processes = slices.Delete(group.Processes, i, i+1)
+			group.Processes = append(group.Processes, s.Spawn(app))
+		}
+		if enterprise && !slices.ContainsFunc(group.Processes, isOld) {
+			group.Restarting = "false"
+		}
+	}
+}
+
+// MemoryLeak grows the real memory of the process at index proc of the app
+// with index app by kilobytes on every step.
+func MemoryLeak(app, proc int, kilobytes int64) Scenario {
+	return func(s *State) {
+		processes := s.Info.SuperGroups[app].DefaultGroup().Processes
+		if proc >= len(processes) {
+			return
+		}
+		p := &processes[proc]
+		p.RealMemory = strconv.FormatInt(parseInt(p.RealMemory)+kilobytes, 10)
+	}
+}
+
+// QueueSurge makes requests pile up in the queue of the app with index app,
+// rising linearly to peak and falling back to zero over steps steps from step
+// start on. While requests are queued, all processes of the app are busy.
+func QueueSurge(app, start, steps, peak int) Scenario {
+	return func(s *State) {
+		sg := &s.Info.SuperGroups[app]
+		elapsed := s.Step - start
+		queued := 0
+		if elapsed >= 0 && elapsed < steps {
+			half := float64(steps) / 2
+			distance := float64(elapsed) - half
+			if distance < 0 {
+				distance = -distance
+			}
+			queued = int(float64(peak) * (1 - distance/half))
+		}
+
+		sg.RequestsInQueue = strconv.Itoa(queued)
+		group := sg.DefaultGroup()
+		for i := range group.Processes {
+			proc := &group.Processes[i]
+			if queued > 0 {
+				proc.Sessions = proc.Concurrency
+				proc.Busyness = "2147483647"
+			} else {
+				proc.Sessions = "0"
+				proc.Busyness = "0"
+			}
+		}
+	}
+}
+
+func clone(info *collector.Info) *collector.Info {
+	c := *info
+	c.SuperGroups = slices.Clone(info.SuperGroups)
+	for i := range c.SuperGroups {
+		sg := &c.SuperGroups[i]
+		sg.Groups = slices.Clone(sg.Groups)
+		for j := range sg.Groups {
+			sg.Groups[j].Processes = slices.Clone(sg.Groups[j].Processes)
+			sg.Groups[j].DetachedProcesses = slices.Clone(sg.Groups[j].DetachedProcesses)
+		}
+	}
+	return &c
+}
+
+// allProcesses returns pointers to the processes of every group.
+func allProcesses(info *collector.Info) []*collector.Process {
+	var procs []*collector.Process
+	for i := range info.SuperGroups {
+		for j := range info.SuperGroups[i].Groups {
+			group := &info.SuperGroups[i].Groups[j]
+			for k := range group.Processes {
+				procs = append(procs, &group.Processes[k])
+			}
+		}
+	}
+	return procs
+}
+
+func parseInt(s string) int64 {
+	v, _ := strconv.ParseInt(s, 10, 64)
+	return v
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pushgateway pushes gathered metrics to a Prometheus Pushgateway.
+package pushgateway
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// GroupingFunc returns the grouping key to push under. It is called before
+// every push, so the key follows the Passenger instance across restarts.
+type GroupingFunc func() (map[string]string, error)
+
+// Pusher replaces the metrics of its group on every push and deletes the
+// group when stopped, so metrics of vanished hosts do not linger.
+type Pusher struct {
+	url      string
+	job      string
+	gatherer prometheus.Gatherer
+	grouping GroupingFunc
+	client   *http.Client
+
+	// pushed is the grouping key of the last successful push.
+	pushed map[string]string
+}
+
+func New(url, job string, gatherer prometheus.Gatherer, grouping GroupingFunc) *Pusher {
+	return &Pusher{
+		url:      url,
+		job:      job,
+		gatherer: gatherer,
+		grouping: grouping,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Push pushes once, deleting the previously pushed group if the grouping key
+// changed in between.
+func (p *Pusher) Push(ctx context.Context) error {
+	grouping, err := p.grouping()
+	if err != nil {
+		return err
+	}
+
+	if p.pushed != nil && !maps.Equal(p.pushed, grouping) {
+		if err := p.Delete(); err != nil {
+			return err
+		}
+	}
+
+	if err := p.pusher(grouping).Gatherer(p.gatherer).PushContext(ctx); err != nil {
+		return err
+	}
+	p.pushed = grouping
+	return nil
+}
+
+// Delete deletes the last pushed group, if any.
+func (p *Pusher) Delete() error {
+	if p.pushed == nil {
+		return nil
+	}
+	if err := p.pusher(p.pushed).Delete(); err != nil {
+		return err
+	}
+	p.pushed = nil
+	return nil
+}
+
+// Run pushes on every tick of interval until ctx is cancelled, then deletes
+// the pushed group.
+func (p *Pusher) Run(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Push(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("Error pushing metrics to Pushgateway", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			if err := p.Delete(); err != nil {
+				logger.Error("Error deleting metrics from Pushgateway", "err", err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Pusher) pusher(grouping map[string]string) *push.Pusher {
+	pusher := push.New(p.url, p.job).Client(p.client)
+	for name, value := range grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	return pusher
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pushgateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/promslog"
+)
+
+type request struct {
+	method   string
+	grouping map[string]string
+}
+
+type fakeGateway struct {
+	sync.Mutex
+	requests []request
+}
+
+func (g *fakeGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Path is /metrics/job/<job>/<name>/<value>/..., in map iteration order.
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/metrics/"), "/")
+	grouping := make(map[string]string)
+	for i := 0; i+1 < len(parts); i += 2 {
+		grouping[parts[i]] = parts[i+1]
+	}
+
+	g.Lock()
+	g.requests = append(g.requests, request{method: r.Method, grouping: grouping})
+	g.Unlock()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (g *fakeGateway) Requests() []request {
+	g.Lock()
+	defer g.Unlock()
+	return append([]request(nil), g.requests...)
+}
+
+func newTestRegistry() *prometheus.Registry {
+	up := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "passenger_up",
+		Help:        "Passenger state.",
+		ConstLabels: prometheus.Labels{"hostname": "local-machine"},
+	})
+	up.Set(1)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(up)
+	return reg
+}
+
+func TestPush(t *testing.T) {
+	gateway := &fakeGateway{}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	instance := "passenger.aBc0d2z"
+	pusher := New(server.URL, "passenger", newTestRegistry(), func() (map[string]string, error) {
+		return map[string]string{"instance": "local-machine", "passenger_instance": instance}, nil
+	})
+
+	if err := pusher.Push(context.Background()); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	// Passenger restarted with a new instance registry directory.
+	instance = "passenger.zk9bVz7"
+	if err := pusher.Push(context.Background()); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	if err := pusher.Delete(); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	// Deleting twice is a no-op.
+	if err := pusher.Delete(); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	want := []request{
+		{method: http.MethodPut, grouping: map[string]string{"job": "passenger", "instance": "local-machine", "passenger_instance": "passenger.aBc0d2z"}},
+		{method: http.MethodDelete, grouping: map[string]string{"job": "passenger", "instance": "local-machine", "passenger_instance": "passenger.aBc0d2z"}},
+		{method: http.MethodPut, grouping: map[string]string{"job": "passenger", "instance": "local-machine", "passenger_instance": "passenger.zk9bVz7"}},
+		{method: http.MethodDelete, grouping: map[string]string{"job": "passenger", "instance": "local-machine", "passenger_instance": "passenger.zk9bVz7"}},
+	}
+	if got := gateway.Requests(); !reflect.DeepEqual(want, got) {
+		t.Errorf("expected requests %v, got %v", want, got)
+	}
+}
+
+func TestPush_GroupingError(t *testing.T) {
+	gateway := &fakeGateway{}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	pusher := New(server.URL, "passenger", newTestRegistry(), func() (map[string]string, error) {
+		return nil, fmt.Errorf("failed to detect Passenger instance registry directory")
+	})
+
+	if err := pusher.Push(context.Background()); err == nil {
+		t.Errorf("expected error, got none")
+	}
+	if got := gateway.Requests(); len(got) != 0 {
+		t.Errorf("expected no requests, got %v", got)
+	}
+}
+
+func TestRun_DeletesOnShutdown(t *testing.T) {
+	gateway := &fakeGateway{}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	pusher := New(server.URL, "passenger", newTestRegistry(), func() (map[string]string, error) {
+		return map[string]string{"instance": "local-machine"}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pusher.Run(ctx, time.Hour, promslog.NewNopLogger())
+		close(done)
+	}()
+
+	for len(gateway.Requests()) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	want := []request{
+		{method: http.MethodPut, grouping: map[string]string{"job": "passenger", "instance": "local-machine"}},
+		{method: http.MethodDelete, grouping: map[string]string{"job": "passenger", "instance": "local-machine"}},
+	}
+	if got := gateway.Requests(); !reflect.DeepEqual(want, got) {
+		t.Errorf("expected requests %v, got %v", want, got)
+	}
+}
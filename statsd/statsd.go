@@ -0,0 +1,265 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package statsd pushes gathered metrics to a StatsD or DogStatsD agent.
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	FormatStatsD    = "statsd"
+	FormatDogStatsD = "dogstatsd"
+
+	// Keep UDP datagrams below the usual Ethernet MTU to avoid fragmentation.
+	maxUDPPacketSize = 1432
+	// Unix datagram sockets are not subject to the MTU.
+	maxUnixgramPacketSize = 8192
+)
+
+type Config struct {
+	// Address is either udp://host:port or unixgram:///path/to/socket.
+	Address string
+	// Format is one of FormatStatsD or FormatDogStatsD.
+	Format string
+	// Prefix is prepended to every metric name, separated by a dot.
+	Prefix string
+}
+
+// Client converts gathered metric families into StatsD lines. Counters are
+// sent as deltas against the previous push, so the first push after start
+// only records their baseline.
+type Client struct {
+	gatherer      prometheus.Gatherer
+	conn          net.Conn
+	format        string
+	prefix        string
+	maxPacketSize int
+
+	counters map[string]float64
+}
+
+func New(gatherer prometheus.Gatherer, cfg Config) (*Client, error) {
+	if cfg.Format != FormatStatsD && cfg.Format != FormatDogStatsD {
+		return nil, fmt.Errorf("unknown statsd format %q", cfg.Format)
+	}
+
+	u, err := url.Parse(cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		conn          net.Conn
+		maxPacketSize int
+	)
+	switch u.Scheme {
+	case "udp":
+		conn, err = net.Dial("udp", u.Host)
+		maxPacketSize = maxUDPPacketSize
+	case "unixgram":
+		conn, err = net.Dial("unixgram", u.Path)
+		maxPacketSize = maxUnixgramPacketSize
+	default:
+		return nil, fmt.Errorf("unsupported statsd address %q, expected udp:// or unixgram://", cfg.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		gatherer:      gatherer,
+		conn:          conn,
+		format:        cfg.Format,
+		prefix:        cfg.Prefix,
+		maxPacketSize: maxPacketSize,
+		counters:      make(map[string]float64),
+	}, nil
+}
+
+// Push gathers once and sends the result.
+func (c *Client) Push() error {
+	families, err := c.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	var (
+		lines    []string
+		counters = make(map[string]float64, len(c.counters))
+	)
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			name, tags := c.series(mf.GetName(), m.GetLabel())
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				lines = append(lines, c.counter(counters, name, tags, m.GetCounter().GetValue())...)
+			case dto.MetricType_GAUGE:
+				lines = append(lines, gauge(name, tags, m.GetGauge().GetValue())...)
+			case dto.MetricType_UNTYPED:
+				lines = append(lines, gauge(name, tags, m.GetUntyped().GetValue())...)
+			case dto.MetricType_SUMMARY:
+				lines = append(lines, c.counter(counters, name+"_sum", tags, m.GetSummary().GetSampleSum())...)
+				lines = append(lines, c.counter(counters, name+"_count", tags, float64(m.GetSummary().GetSampleCount()))...)
+			case dto.MetricType_HISTOGRAM:
+				lines = append(lines, c.counter(counters, name+"_sum", tags, m.GetHistogram().GetSampleSum())...)
+				lines = append(lines, c.counter(counters, name+"_count", tags, float64(m.GetHistogram().GetSampleCount()))...)
+			}
+		}
+	}
+	// Series that disappeared are forgotten, so a returning series starts
+	// from a fresh baseline.
+	c.counters = counters
+
+	return c.send(lines)
+}
+
+// Run pushes on every tick of interval until ctx is cancelled.
+func (c *Client) Run(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.Push(); err != nil {
+			logger.Error("Error pushing metrics to statsd", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// series returns the metric name and the tag suffix of a line. DogStatsD
+// carries labels as tags, while plain StatsD has no notion of tags and gets
+// the label values appended to the name instead, in label name order as
+// returned by the gatherer.
+func (c *Client) series(name string, labels []*dto.LabelPair) (string, string) {
+	if c.prefix != "" {
+		name = c.prefix + "." + name
+	}
+
+	if c.format == FormatStatsD {
+		var b strings.Builder
+		b.WriteString(name)
+		for _, l := range labels {
+			if l.GetValue() == "" {
+				continue
+			}
+			b.WriteByte('.')
+			b.WriteString(statsdReplacer.Replace(l.GetValue()))
+		}
+		return b.String(), ""
+	}
+
+	tags := make([]string, 0, len(labels))
+	for _, l := range labels {
+		tags = append(tags, l.GetName()+":"+dogstatsdReplacer.Replace(l.GetValue()))
+	}
+	if len(tags) == 0 {
+		return name, ""
+	}
+	return name, "|#" + strings.Join(tags, ",")
+}
+
+func (c *Client) counter(seen map[string]float64, name, tags string, v float64) []string {
+	if math.IsNaN(v) {
+		return nil
+	}
+
+	key := name + tags
+	seen[key] = v
+
+	prev, ok := c.counters[key]
+	if !ok {
+		return nil
+	}
+	delta := v - prev
+	if delta < 0 {
+		// The counter was reset, everything it reports happened since.
+		delta = v
+	}
+	if delta == 0 {
+		return nil
+	}
+	return []string{name + ":" + formatValue(delta) + "|c" + tags}
+}
+
+func gauge(name, tags string, v float64) []string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	// A leading sign makes StatsD adjust the gauge rather than set it, so a
+	// negative value has to be sent as a reset to zero followed by a
+	// decrement.
+	if v < 0 {
+		return []string{
+			name + ":0|g" + tags,
+			name + ":" + formatValue(v) + "|g" + tags,
+		}
+	}
+	return []string{name + ":" + formatValue(v) + "|g" + tags}
+}
+
+// send writes lines newline separated, packing as many as fit in a single
+// datagram.
+func (c *Client) send(lines []string) error {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		if buf.Len() > 0 && buf.Len()+1+len(line) > c.maxPacketSize {
+			if _, err := c.conn.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	if buf.Len() > 0 {
+		if _, err := c.conn.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	statsdReplacer    = strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", " ", "_", "/", "_", "\n", "_")
+	dogstatsdReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+)
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,210 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newTestRegistry() (*prometheus.Registry, *prometheus.GaugeVec, *prometheus.CounterVec) {
+	sessions := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "passenger_current_sessions",
+		Help:        "Number of sessions currently being handled by a process.",
+		ConstLabels: prometheus.Labels{"hostname": "local-machine"},
+	}, []string{"name", "id"})
+	processed := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "passenger_requests_processed_total",
+		Help:        "Number of processes served by a process.",
+		ConstLabels: prometheus.Labels{"hostname": "local-machine"},
+	}, []string{"name", "id"})
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(sessions, processed)
+	return reg, sessions, processed
+}
+
+func listenUDP(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func receive(t *testing.T, conn net.PacketConn) []string {
+	buf := make([]byte, maxUnixgramPacketSize)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("failed to read packet: %v", err)
+	}
+	lines := strings.Split(string(buf[:n]), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestPush_DogStatsD(t *testing.T) {
+	reg, sessions, processed := newTestRegistry()
+	sessions.WithLabelValues("/srv/app/my_app (production)", "0").Set(1)
+	processed.WithLabelValues("/srv/app/my_app (production)", "0").Add(10)
+
+	listener := listenUDP(t)
+	client, err := New(reg, Config{Address: "udp://" + listener.LocalAddr().String(), Format: FormatDogStatsD})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Push(); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	// The first push only records the counter baseline.
+	want := []string{
+		"passenger_current_sessions:1|g|#hostname:local-machine,id:0,name:/srv/app/my_app (production)",
+	}
+	if got := receive(t, listener); !reflect.DeepEqual(want, got) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	sessions.WithLabelValues("/srv/app/my_app (production)", "0").Set(0)
+	processed.WithLabelValues("/srv/app/my_app (production)", "0").Add(5)
+
+	if err := client.Push(); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	want = []string{
+		"passenger_current_sessions:0|g|#hostname:local-machine,id:0,name:/srv/app/my_app (production)",
+		"passenger_requests_processed_total:5|c|#hostname:local-machine,id:0,name:/srv/app/my_app (production)",
+	}
+	if got := receive(t, listener); !reflect.DeepEqual(want, got) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestPush_StatsD(t *testing.T) {
+	reg, sessions, _ := newTestRegistry()
+	sessions.WithLabelValues("/srv/app/my_app (production)", "3").Set(2)
+
+	listener := listenUDP(t)
+	client, err := New(reg, Config{Address: "udp://" + listener.LocalAddr().String(), Format: FormatStatsD, Prefix: "web"})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Push(); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	want := []string{"web.passenger_current_sessions.local-machine.3._srv_app_my_app_(production):2|g"}
+	if got := receive(t, listener); !reflect.DeepEqual(want, got) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestPush_Unixgram(t *testing.T) {
+	dir, err := os.MkdirTemp("", "statsd")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dsd.socket")
+	listener, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	reg, sessions, _ := newTestRegistry()
+	sessions.WithLabelValues("app", "0").Set(1)
+
+	client, err := New(reg, Config{Address: "unixgram://" + path, Format: FormatDogStatsD})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Push(); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	want := []string{"passenger_current_sessions:1|g|#hostname:local-machine,id:0,name:app"}
+	if got := receive(t, listener); !reflect.DeepEqual(want, got) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestPush_SplitsPackets(t *testing.T) {
+	reg, sessions, _ := newTestRegistry()
+	for i := 0; i < 100; i++ {
+		sessions.WithLabelValues("/srv/app/my_app (production)", strings.Repeat("x", i)).Set(1)
+	}
+
+	listener := listenUDP(t)
+	client, err := New(reg, Config{Address: "udp://" + listener.LocalAddr().String(), Format: FormatDogStatsD})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Push(); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+
+	total := 0
+	for total < 100 {
+		buf := make([]byte, 65535)
+		listener.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := listener.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("failed to read packet after %d lines: %v", total, err)
+		}
+		if n > maxUDPPacketSize {
+			t.Errorf("packet of %d bytes exceeds the maximum of %d", n, maxUDPPacketSize)
+		}
+		total += len(strings.Split(string(buf[:n]), "\n"))
+	}
+	if total != 100 {
+		t.Errorf("expected 100 lines, got %d", total)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	tests := []struct {
+		cfg     Config
+		wantErr string
+	}{
+		{cfg: Config{Address: "udp://127.0.0.1:8125", Format: "graphite"}, wantErr: `unknown statsd format "graphite"`},
+		{cfg: Config{Address: "tcp://127.0.0.1:8125", Format: FormatStatsD}, wantErr: `unsupported statsd address "tcp://127.0.0.1:8125", expected udp:// or unixgram://`},
+	}
+
+	for _, test := range tests {
+		_, err := New(prometheus.NewRegistry(), test.cfg)
+		if err == nil {
+			t.Fatalf("expected error %q, got none", test.wantErr)
+		}
+		if err.Error() != test.wantErr {
+			t.Errorf("expected error %q, got %q", test.wantErr, err.Error())
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package textfile writes gathered metrics for the node_exporter textfile
+// collector.
+package textfile
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Write gathers once and replaces the file at path with the result. The
+// metrics are written to a temporary file in the same directory first and
+// renamed into place, so node_exporter never reads a partial file. On a
+// gathering error the previous file is left untouched.
+func Write(gatherer prometheus.Gatherer, path string, mode os.FileMode) error {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	// The temporary file must not end in .prom, or node_exporter would pick
+	// it up.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	encoder := expfmt.NewEncoder(tmp, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, mf := range families {
+		if err := encoder.Encode(mf); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Run writes on every tick of interval until ctx is cancelled.
+func Run(ctx context.Context, gatherer prometheus.Gatherer, path string, mode os.FileMode, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := Write(gatherer, path, mode); err != nil {
+			logger.Error("Error writing textfile", "path", path, "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
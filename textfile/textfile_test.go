@@ -0,0 +1,94 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package textfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type failingCollector struct{}
+
+func (failingCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (failingCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("passenger_read_error", "Error reading metrics data.", nil, nil), fmt.Errorf("fake"))
+}
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "passenger.prom")
+
+	up := prometheus.NewGauge(prometheus.GaugeOpts{Name: "passenger_up", Help: "Passenger state."})
+	up.Set(1)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(up)
+
+	if err := Write(reg, path, 0640); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read textfile: %v", err)
+	}
+	want := "# HELP passenger_up Passenger state.\n# TYPE passenger_up gauge\npassenger_up 1\n"
+	if string(data) != want {
+		t.Errorf("expected %q, got %q", want, string(data))
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat textfile: %v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("expected mode %o, got %o", 0640, info.Mode().Perm())
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the textfile in the directory, got %d entries", len(entries))
+	}
+}
+
+func TestWrite_KeepsFileOnError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "passenger.prom")
+
+	if err := os.WriteFile(path, []byte("passenger_up 1\n"), 0644); err != nil {
+		t.Fatalf("failed to create textfile: %v", err)
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(failingCollector{})
+
+	if err := Write(reg, path, 0644); err == nil {
+		t.Errorf("expected error, got none")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read textfile: %v", err)
+	}
+	if string(data) != "passenger_up 1\n" {
+		t.Errorf("expected previous textfile to be kept, got %q", string(data))
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/prometheus/common/model"
+	"go.yaml.in/yaml/v2"
+)
+
+type Config struct {
+	Webhooks []Webhook `yaml:"webhooks"`
+	// ForgetAppsAfter is how long an app may be missing from the pool, e.g.
+	// while it restarts, before it is forgotten and its alerts resolve.
+	// Defaults to 10m.
+	ForgetAppsAfter model.Duration `yaml:"forget_apps_after,omitempty"`
+}
+
+// Webhook is notified when its condition holds for an app.
+type Webhook struct {
+	Name    string            `yaml:"name"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Template is a text/template of the request body, executed with a
+	// Notification. Defaults to the notification as JSON.
+	Template  string    `yaml:"template,omitempty"`
+	Condition Condition `yaml:"condition"`
+
+	// SendResolved also notifies when the condition stops holding.
+	SendResolved bool `yaml:"send_resolved,omitempty"`
+	// RepeatInterval notifies again while the condition keeps holding. 0
+	// notifies once.
+	RepeatInterval model.Duration `yaml:"repeat_interval,omitempty"`
+	// Retries is the number of times a failed notification is retried.
+	// Retries are RetryInterval apart at first, 10s by default, doubling
+	// with every attempt up to 5m.
+	Retries       int            `yaml:"retries,omitempty"`
+	RetryInterval model.Duration `yaml:"retry_interval,omitempty"`
+}
+
+// Condition holds for an app once one of its thresholds has been crossed for
+// For. Exactly one threshold must be set.
+type Condition struct {
+	// QueueAbove holds when more requests than this wait in the queue of
+	// the app.
+	QueueAbove *int `yaml:"queue_above,omitempty"`
+	// ProcessesBelow holds when the app has fewer processes than this, e.g.
+	// 1 when the process count dropped to 0.
+	ProcessesBelow *int           `yaml:"processes_below,omitempty"`
+	For            model.Duration `yaml:"for,omitempty"`
+}
+
+// LoadConfig reads the webhooks config file at path.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return config, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return config, config.validate()
+}
+
+func (c *Config) validate() error {
+	if c.ForgetAppsAfter < 0 {
+		return fmt.Errorf("forget_apps_after is negative")
+	}
+	names := make(map[string]bool)
+	for i, webhook := range c.Webhooks {
+		if webhook.Name == "" {
+			return fmt.Errorf("webhook %d has no name", i)
+		}
+		if names[webhook.Name] {
+			return fmt.Errorf("webhook %q is defined twice", webhook.Name)
+		}
+		names[webhook.Name] = true
+
+		if u, err := url.Parse(webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("webhook %q has an invalid URL %q", webhook.Name, webhook.URL)
+		}
+		if (webhook.Condition.QueueAbove == nil) == (webhook.Condition.ProcessesBelow == nil) {
+			return fmt.Errorf("webhook %q must set exactly one of queue_above and processes_below", webhook.Name)
+		}
+		if webhook.Retries < 0 {
+			return fmt.Errorf("webhook %q has negative retries", webhook.Name)
+		}
+		if webhook.RetryInterval < 0 {
+			return fmt.Errorf("webhook %q has a negative retry interval", webhook.Name)
+		}
+	}
+	return nil
+}
+
+// String describes the threshold of c, e.g. "queue > 50".
+func (c Condition) String() string {
+	if c.QueueAbove != nil {
+		return fmt.Sprintf("queue > %d", *c.QueueAbove)
+	}
+	return fmt.Sprintf("processes < %d", *c.ProcessesBelow)
+}
@@ -0,0 +1,283 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package webhook notifies HTTP endpoints when conditions on the pools read
+// by the collector hold for an app.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/nex-health/passenger-exporter/collector"
+	"github.com/prometheus/common/model"
+)
+
+// Statuses of a notification.
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+const (
+	// defaultRetryInterval is the delay before the first retry of a webhook
+	// without a retry interval.
+	defaultRetryInterval = 10 * time.Second
+	// defaultForgetAppsAfter is how long an app may be missing from the pool
+	// by default.
+	defaultForgetAppsAfter = 10 * time.Minute
+	// maxRetryInterval caps the delay between retries, which doubles with
+	// every attempt.
+	maxRetryInterval = 5 * time.Minute
+)
+
+// Notification is the body sent to a webhook, as JSON or through its
+// template.
+type Notification struct {
+	Webhook   string `json:"webhook"`
+	Status    string `json:"status"`
+	App       string `json:"app"`
+	Condition string `json:"condition"`
+	// Value is the queue size or process count of the app.
+	Value int `json:"value"`
+	// Since is when the condition started holding.
+	Since time.Time `json:"since"`
+}
+
+// alert is the state of the condition of a webhook for an app.
+type alert struct {
+	// pendingSince is when the condition started holding.
+	pendingSince time.Time
+	firing       bool
+	lastSent     time.Time
+}
+
+type alertKey struct {
+	webhook, app string
+}
+
+// Notifier observes the pools read by the collector and notifies webhooks
+// once their condition has held for an app for long enough. A firing
+// condition is notified once, or every repeat interval, until it resolves.
+// Notifications are sent in the background, so scrapes do not wait for them.
+type Notifier struct {
+	ctx             context.Context
+	webhooks        []Webhook
+	templates       []*template.Template
+	forgetAppsAfter time.Duration
+	client          *http.Client
+	logger          *slog.Logger
+
+	mu     sync.Mutex
+	alerts map[alertKey]*alert
+	// apps holds when every app not forgotten yet was last seen in a pool.
+	apps    map[string]time.Time
+	sending sync.WaitGroup
+}
+
+// New returns a Notifier of the webhooks of config. Once ctx is done,
+// notifications being sent are abandoned instead of retried.
+func New(ctx context.Context, config Config, logger *slog.Logger) (*Notifier, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	webhooks := slices.Clone(config.Webhooks)
+	templates := make([]*template.Template, len(webhooks))
+	for i := range webhooks {
+		webhook := &webhooks[i]
+		if webhook.RetryInterval == 0 {
+			webhook.RetryInterval = model.Duration(defaultRetryInterval)
+		}
+		if webhook.Template == "" {
+			continue
+		}
+		tmpl, err := template.New(webhook.Name).Parse(webhook.Template)
+		if err != nil {
+			return nil, fmt.Errorf("parsing template of webhook %q: %w", webhook.Name, err)
+		}
+		templates[i] = tmpl
+	}
+	forgetAppsAfter := time.Duration(config.ForgetAppsAfter)
+	if forgetAppsAfter == 0 {
+		forgetAppsAfter = defaultForgetAppsAfter
+	}
+	return &Notifier{
+		ctx:             ctx,
+		forgetAppsAfter: forgetAppsAfter,
+		webhooks:        webhooks,
+		templates:       templates,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		logger:          logger,
+		alerts:          make(map[alertKey]*alert),
+		apps:            make(map[string]time.Time),
+	}, nil
+}
+
+// Observe evaluates the condition of every webhook against the apps of info
+// at at. Apps missing from info have no queue and no processes, so they keep a
+// processes_below condition holding until they have been missing for the
+// forget_apps_after of the config. They are then forgotten, resolving their
+// alerts.
+func (n *Notifier) Observe(at time.Time, info *collector.Info) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	pool := make(map[string]*collector.SuperGroup)
+	for i := range info.SuperGroups {
+		sg := &info.SuperGroups[i]
+		pool[sg.Name] = sg
+		n.apps[sg.Name] = at
+	}
+	for _, app := range slices.Sorted(maps.Keys(n.apps)) {
+		forget := pool[app] == nil && at.Sub(n.apps[app]) >= n.forgetAppsAfter
+		for i := range n.webhooks {
+			key := alertKey{n.webhooks[i].Name, app}
+			if forget {
+				n.update(i, key, at, 0, false)
+				continue
+			}
+			value, holds := evaluate(n.webhooks[i].Condition, pool[app])
+			n.update(i, key, at, value, holds)
+		}
+		if forget {
+			delete(n.apps, app)
+		}
+	}
+}
+
+// Wait waits for the notifications being sent.
+func (n *Notifier) Wait() {
+	n.sending.Wait()
+}
+
+// update moves the alert of key to its next state given whether its
+// condition holds at at, sending the notifications due.
+func (n *Notifier) update(i int, key alertKey, at time.Time, value int, holds bool) {
+	webhook := &n.webhooks[i]
+	a, ok := n.alerts[key]
+	if !holds {
+		if ok && a.firing && webhook.SendResolved {
+			n.send(i, Notification{Status: StatusResolved, App: key.app, Value: value, Since: a.pendingSince})
+		}
+		delete(n.alerts, key)
+		return
+	}
+	if !ok {
+		a = &alert{pendingSince: at}
+		n.alerts[key] = a
+	}
+	if at.Sub(a.pendingSince) < time.Duration(webhook.Condition.For) {
+		return
+	}
+
+	repeat := time.Duration(webhook.RepeatInterval)
+	if a.firing && (repeat <= 0 || at.Sub(a.lastSent) < repeat) {
+		return
+	}
+	a.firing = true
+	a.lastSent = at
+	n.send(i, Notification{Status: StatusFiring, App: key.app, Value: value, Since: a.pendingSince})
+}
+
+// evaluate returns the value of the condition for sg and whether it holds. A
+// nil sg is an app missing from the pool.
+func evaluate(condition Condition, sg *collector.SuperGroup) (int, bool) {
+	if sg == nil {
+		sg = &collector.SuperGroup{}
+	}
+	if condition.QueueAbove != nil {
+		size := sg.Queue()
+		return size, size > *condition.QueueAbove
+	}
+	processes := 0
+	for _, group := range sg.Groups {
+		processes += len(group.Processes)
+	}
+	return processes, processes < *condition.ProcessesBelow
+}
+
+func (n *Notifier) send(i int, notification Notification) {
+	webhook := n.webhooks[i]
+	notification.Webhook = webhook.Name
+	notification.Condition = webhook.Condition.String()
+
+	var body bytes.Buffer
+	var err error
+	contentType := "application/json"
+	if tmpl := n.templates[i]; tmpl != nil {
+		err = tmpl.Execute(&body, notification)
+		contentType = "text/plain; charset=utf-8"
+	} else {
+		err = json.NewEncoder(&body).Encode(notification)
+	}
+	if err != nil {
+		n.logger.Error("Error rendering webhook notification", "webhook", webhook.Name, "app", notification.App, "err", err)
+		return
+	}
+
+	n.sending.Go(func() {
+		delay := time.Duration(webhook.RetryInterval)
+		for attempt := 0; ; attempt++ {
+			err := n.post(&webhook, contentType, body.Bytes())
+			if err == nil {
+				n.logger.Info("Sent webhook notification", "webhook", webhook.Name, "app", notification.App,
+					"status", notification.Status)
+				return
+			}
+			if attempt >= webhook.Retries {
+				n.logger.Error("Error sending webhook notification", "webhook", webhook.Name, "app", notification.App,
+					"status", notification.Status, "attempts", attempt+1, "err", err)
+				return
+			}
+			select {
+			case <-n.ctx.Done():
+				n.logger.Error("Abandoned webhook notification", "webhook", webhook.Name, "app", notification.App,
+					"status", notification.Status, "attempts", attempt+1, "err", err)
+				return
+			case <-time.After(delay):
+			}
+			delay = min(2*delay, maxRetryInterval)
+		}
+	})
+}
+
+func (n *Notifier) post(webhook *Webhook, contentType string, body []byte) error {
+	req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for name, value := range webhook.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+// Copyright 2024 NexHealth Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nex-health/passenger-exporter/collector"
+	"github.com/nex-health/passenger-exporter/passengertest"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/common/promslog"
+)
+
+// receiver records the requests it receives, failing the first fail ones.
+type receiver struct {
+	mu       sync.Mutex
+	fail     int
+	attempts []time.Time
+	bodies   []string
+	header   http.Header
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts = append(r.attempts, time.Now())
+	if r.fail > 0 {
+		r.fail--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(req.Body)
+	r.bodies = append(r.bodies, string(body))
+	r.header = req.Header.Clone()
+}
+
+func (r *receiver) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.bodies...)
+}
+
+func intp(n int) *int {
+	return &n
+}
+
+func TestNotifier_Queue(t *testing.T) {
+	r := &receiver{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	n, err := New(t.Context(), Config{Webhooks: []Webhook{{
+		Name:           "queue",
+		URL:            srv.URL,
+		Headers:        map[string]string{"Authorization": "Bearer token"},
+		Condition:      Condition{QueueAbove: intp(10), For: model.Duration(time.Minute)},
+		RepeatInterval: model.Duration(10 * time.Minute),
+		SendResolved:   true,
+	}}}, promslog.NewNopLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	for i, tc := range []struct {
+		after time.Duration
+		info  *collector.Info
+		want  int
+	}{
+		{info: passengertest.Generate(passengertest.Spec{AppQueue: 11}), want: 0},
+		// The condition must hold for a minute without interruption.
+		{after: 30 * time.Second, info: passengertest.Generate(passengertest.Spec{AppQueue: 5}), want: 0},
+		{after: 30 * time.Second, info: passengertest.Generate(passengertest.Spec{AppQueue: 11}), want: 0},
+		{after: time.Minute, info: passengertest.Generate(passengertest.Spec{AppQueue: 12}), want: 1},
+		// Firing conditions are not sent again before the repeat interval.
+		{after: time.Minute, info: passengertest.Generate(passengertest.Spec{AppQueue: 12}), want: 1},
+		{after: 9 * time.Minute, info: passengertest.Generate(passengertest.Spec{AppQueue: 12}), want: 2},
+		{after: time.Minute, info: passengertest.Generate(passengertest.Spec{}), want: 3},
+		{after: time.Minute, info: passengertest.Generate(passengertest.Spec{}), want: 3},
+	} {
+		now = now.Add(tc.after)
+		n.Observe(now, tc.info)
+		n.Wait()
+		if got := len(r.received()); got != tc.want {
+			t.Errorf("%d: got %d notifications, want %d", i, got, tc.want)
+		}
+	}
+
+	var firing, resolved Notification
+	bodies := r.received()
+	if err := json.Unmarshal([]byte(bodies[0]), &firing); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := json.Unmarshal([]byte(bodies[2]), &resolved); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	since := time.Date(2024, 5, 6, 7, 9, 9, 0, time.UTC)
+	if want := (Notification{Webhook: "queue", Status: StatusFiring, App: "/srv/app/app0 (production)", Condition: "queue > 10", Value: 12, Since: since}); firing != want {
+		t.Errorf("got %+v, want %+v", firing, want)
+	}
+	if resolved.Status != StatusResolved || !resolved.Since.Equal(since) {
+		t.Errorf("got %+v, want resolved since %s", resolved, since)
+	}
+	if got := r.header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("got Authorization %q, want %q", got, "Bearer token")
+	}
+}
+
+func TestNotifier_ProcessesAndTemplate(t *testing.T) {
+	r := &receiver{fail: 2}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	n, err := New(t.Context(), Config{Webhooks: []Webhook{{
+		Name:          "down",
+		URL:           srv.URL,
+		Template:      `{{ .App }} is {{ .Status }}: {{ .Condition }}`,
+		Condition:     Condition{ProcessesBelow: intp(1)},
+		Retries:       2,
+		RetryInterval: model.Duration(50 * time.Millisecond),
+	}}}, promslog.NewNopLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	down := passengertest.Generate(passengertest.Spec{})
+	down.SuperGroups[0].DefaultGroup().Processes = nil
+	n.Observe(now, passengertest.Generate(passengertest.Spec{}))
+	n.Observe(now.Add(time.Second), down)
+	// Without a repeat interval, firing conditions are sent once.
+	n.Observe(now.Add(2*time.Second), down)
+	n.Wait()
+
+	want := []string{"/srv/app/app0 (production) is firing: processes < 1"}
+	if got := r.received(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// The retry interval doubles with every attempt.
+	if len(r.attempts) != 3 {
+		t.Fatalf("got %d attempts, want 3", len(r.attempts))
+	}
+	if got := r.attempts[2].Sub(r.attempts[1]); got < 100*time.Millisecond {
+		t.Errorf("got %s between the retries, want at least 100ms", got)
+	}
+}
+
+func TestNotifier_AppDisappears(t *testing.T) {
+	r := &receiver{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	n, err := New(t.Context(), Config{Webhooks: []Webhook{
+		{Name: "down", URL: srv.URL, Condition: Condition{ProcessesBelow: intp(1), For: model.Duration(time.Minute)}, SendResolved: true},
+		{Name: "queue", URL: srv.URL, Condition: Condition{QueueAbove: intp(10)}, SendResolved: true},
+	}, ForgetAppsAfter: model.Duration(5 * time.Minute)}, promslog.NewNopLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	// An app missing from the pool has no processes and no queue, until it
+	// is forgotten.
+	for _, tc := range []struct {
+		after time.Duration
+		info  *collector.Info
+	}{
+		{info: passengertest.Generate(passengertest.Spec{AppQueue: 11})},
+		{after: time.Second, info: &collector.Info{}},
+		{after: 2 * time.Minute, info: &collector.Info{}},
+		{after: 2 * time.Minute, info: &collector.Info{}},
+		{after: time.Minute, info: &collector.Info{}},
+		{after: time.Minute, info: &collector.Info{}},
+	} {
+		now = now.Add(tc.after)
+		n.Observe(now, tc.info)
+		n.Wait()
+	}
+
+	var got []string
+	for _, body := range r.received() {
+		var notification Notification
+		if err := json.Unmarshal([]byte(body), &notification); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, notification.Webhook+" "+notification.Status)
+	}
+	want := []string{"queue firing", "queue resolved", "down firing", "down resolved"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNotifier_Canceled(t *testing.T) {
+	r := &receiver{fail: 10}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	n, err := New(ctx, Config{Webhooks: []Webhook{{
+		Name:      "down",
+		URL:       srv.URL,
+		Condition: Condition{ProcessesBelow: intp(1)},
+		Retries:   10,
+	}}}, promslog.NewNopLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	down := passengertest.Generate(passengertest.Spec{})
+	down.SuperGroups[0].DefaultGroup().Processes = nil
+	n.Observe(time.Now(), down)
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		n.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("notification was still retried after the context was canceled")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name, config, err string
+	}{
+		{
+			name: "valid",
+			config: `webhooks:
+- name: queue
+  url: http://localhost:9000/hook
+  condition: {queue_above: 50, for: 2m}
+  retries: 3
+  retry_interval: 5s
+`,
+		},
+		{
+			name:   "no condition",
+			config: "webhooks:\n- name: queue\n  url: http://localhost:9000/hook\n",
+			err:    "must set exactly one of queue_above and processes_below",
+		},
+		{
+			name:   "invalid url",
+			config: "webhooks:\n- name: queue\n  url: localhost\n  condition: {queue_above: 50}\n",
+			err:    "invalid URL",
+		},
+		{
+			name:   "unknown field",
+			config: "webhooks:\n- name: queue\n  uri: http://localhost:9000/hook\n",
+			err:    "not found",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "webhooks.yml")
+			if err := os.WriteFile(path, []byte(tc.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			config, err := LoadConfig(path)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("got error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := config.Webhooks[0]; *got.Condition.QueueAbove != 50 || got.Condition.For != model.Duration(2*time.Minute) || got.Retries != 3 {
+				t.Errorf("unexpected config %+v", got)
+			}
+		})
+	}
+}